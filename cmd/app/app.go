@@ -2,25 +2,39 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetservice"
 
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/lint"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/pool"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/retry"
 	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
 	"github.com/gobuffalo/envy"
 
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
-
 	"github.com/pkg/errors"
 
-	"github.com/sendgrid/sendgrid-go"
-
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -29,14 +43,35 @@ const (
 	messageSender  = "SprintHub"
 	fromEmail      = "noreply@sprinthub.com.ng"
 	messageSubject = "Co-working Space Subscription Expiry"
-	messageText    = "Your SprintHub co-working space subscription will expire in %s days. You can contact us to renew your subscription."
+	messageText    = "Your %s co-working space subscription will expire in %s. You can contact us to renew your subscription."
+	// Message texts for reminders sent on or after the day of expiry
+	messageSubjectToday = "Co-working Space Subscription Expires Today"
+	messageTextToday    = "Your %s co-working space subscription expires today. You can contact us to renew your subscription."
+	messageSubjectAfter = "Co-working Space Subscription Expired"
+	messageTextAfter    = "Your %s co-working space subscription expired %s ago. You can contact us to renew your subscription."
+	// Message texts for the emails sent on lifecycle transitions. The texts start with the hub's name.
+	messageSubjectExpired     = "Your Co-working Space Subscription Has Expired"
+	messageTextExpired        = "Your %s co-working space subscription expired today. You can contact us to renew your subscription."
+	messageTextExpiredGrace   = "Your %s co-working space subscription expired today. Your grace period lasts until %s, renew before then to keep your place."
+	messageSubjectGraceEnding = "Your Co-working Space Grace Period Ends Soon"
+	messageTextGraceEnding    = "The grace period of your %s co-working space subscription ends in %s, on %s. You can contact us to renew your subscription."
+	messageSubjectWinBack     = "We Miss You at SprintHub"
+	messageTextWinBack        = "It has been %[2]s since your %[1]s co-working space subscription ended, and we miss you. Contact us whenever you want to come back."
+	// Email template used by reminders that don't configure their own
+	defaultTemplate = "email-template.html"
+	// Number of emails sent at the same time, and how many may be started each second
+	defaultSendConcurrency = 5
+	defaultSendRate        = 10
+	// Number of runs that may fail to send a reminder, and for how long, before it is given up on
+	defaultDeadLetterAttempts = 3
+	defaultDeadLetterMaxAge   = 72 * time.Hour
 	// ErrFmtMissingEnvVar will be raised when required environment variables are missing
-	ErrFmtMissingEnvVar = "Missing environment variable %s"
+	ErrFmtMissingEnvVar  = "Missing environment variable %s"
+	ErrFmtMissingEnvVars = "Missing environment variables %s"
 )
 
 var (
 	enableSandboxMode bool
-	sendGridAPIKey    string
 	clientSecret      string
 	sheetsAPIToken    string
 	spreadsheetID     string
@@ -45,42 +80,258 @@ var (
 	cronHeader        string
 	// Data range to be read from the spreadsheet
 	readRange     string
-	srv           *sheets.Service
-	emailTemplate *template.Template
-	mailClient    *sendgrid.Client
+	headerAliases = sheetdata.DefaultAliases()
+	dateLayouts   = sheetdata.DefaultDateLayouts
+	// Time zone of the hub, in which end dates and days left are counted
+	hubLocation = sheetdata.DefaultLocation()
+	srv         *sheets.Service
+	subscribers source.SubscriberSource
+	mailClient  mailer.Mailer
+	// Reminder schedule and the email templates it uses, keyed by file name
+	policy reminder.Policy
+	// Reminder schedules of the plans that don't follow the default one, keyed by plan name in lower case
+	planPolicies   = map[string]reminder.Policy{}
+	emailTemplates = map[string]*template.Template{}
+	// States a subscription goes through after its reminders, and the lengths of the grace period and lapse
+	lifecycle = reminder.DefaultLifecycle
+	// Whether the lifecycle emails are sent, LIFECYCLE_EMAILS. They are off unless turned on.
+	lifecycleEmails bool
+	// Record of reminders already sent, so repeated cron pings don't email anyone twice
+	sentLedger ledger.Store
+	// Reminders that failed after all retries, retried first by the next run
+	deadLetters ledger.DeadLetters = &ledger.MemoryDeadLetters{}
+	// How calls to the Sheets API and the mail provider are retried
+	retryPolicy = retry.DefaultPolicy
+	// How many runs may fail to send a dead letter, and how long after the first failure it is still retried
+	deadLetterAttempts = defaultDeadLetterAttempts
+	deadLetterMaxAge   = defaultDeadLetterMaxAge
+	// Only one cron run may check and update the ledger at a time
+	runMu sync.Mutex
+	// Workers that send the emails of a run
+	sendPool = pool.New(defaultSendConcurrency, defaultSendRate)
+	// Done when the server starts shutting down, so runs stop handing out queued sends
+	shutdown = context.Background()
+	// Limits for the sheet validation
+	lintOptions lint.Options
+	// Sender of the emails of a single hub deployment, and of hubs that don't set their own
+	mainSender = sender{Name: messageSender, Email: fromEmail}
+	// Email template of the reminders that don't configure their own, EMAIL_TEMPLATE. If it is empty they use
+	// their stage's template in TEMPLATE_DIR, or the default template.
+	reminderTemplate string
 )
 
 func main() {
-	if err := setupEnvVars(map[string]*string{
-		"SENDGRID_API_KEY": &sendGridAPIKey,
-		"SPREADSHEET_ID":   &spreadsheetID,
-		"READ_RANGE":       &readRange,
-		"ENV":              &env,
-		"CLIENT_SECRET":    &clientSecret,
-		"PORT":             &port,
-		"CRON_HEADER":      &cronHeader,
-	}); err != nil {
-		log.Fatalf("%+v\n", err)
+	dryRun := flag.Bool("dry-run", false, "Print the reminders that would be sent as JSON and exit without sending")
+	asOf := flag.String("as-of", "", "With -dry-run, plan the reminders for this day (YYYY-MM-DD) instead of today")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [validate]\n\n"+
+			"Without a command, serves the cron endpoint. The validate command prints a report of problems\n"+
+			"in the subscribers sheet as JSON and exits with status 1 if there are any.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *asOf != "" && !*dryRun {
+		log.Fatalln("-as-of can only be used with -dry-run")
+	}
+	command := flag.Arg(0)
+	if command != "" && command != "validate" {
+		flag.Usage()
+		os.Exit(2)
 	}
+	// Settings of the config file, which environment variables override
+	configHubs, problems := loadConfigFile(envy.Get("CONFIG_FILE", ""))
+	// Every problem with the configuration is collected, so they can all be fixed at once
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	check(setupEnvVars(map[string]*string{
+		"ENV": &env,
+	}))
 	if env == "dev" {
 		enableSandboxMode = true
 	}
-	srv = sheetsservice.NewSheetsService([]byte(clientSecret))
-	if srv == nil {
-		log.Fatalln("Sheets service configuration failed")
+	// Extra header names for the spreadsheet columns, e.g. EMAIL_HEADERS="Email Address,Mail"
+	for envVar, field := range map[string]string{
+		"FIRST_NAME_HEADERS": sheetdata.FieldFirstName,
+		"LAST_NAME_HEADERS":  sheetdata.FieldLastName,
+		"EMAIL_HEADERS":      sheetdata.FieldEmail,
+		"END_DATE_HEADERS":   sheetdata.FieldEndDate,
+		"STATUS_HEADERS":     sheetdata.FieldReminderStatus,
+		"PLAN_HEADERS":       sheetdata.FieldPlan,
+	} {
+		if names := envy.Get(envVar, ""); names != "" {
+			headerAliases.Add(field, strings.Split(names, ",")...)
+		}
+	}
+	// Layouts for end dates written as text, in Go's reference time format, e.g. DATE_LAYOUTS="2/1/2006;2006-01-02"
+	if layouts := envy.Get("DATE_LAYOUTS", ""); layouts != "" {
+		dateLayouts = strings.Split(layouts, ";")
+	}
+	if location, err := sheetdata.LoadLocation(envy.Get("HUB_TIMEZONE", sheetdata.DefaultTimezone)); err != nil {
+		check(errors.Wrap(err, "Bad HUB_TIMEZONE value"))
+	} else {
+		hubLocation = location
+	}
+	var err error
+	retryPolicy, err = loadRetryPolicy()
+	check(err)
+	deadLetterAttempts, deadLetterMaxAge, err = loadDeadLetterLimits()
+	check(err)
+	lintOptions, err = loadLintOptions()
+	check(err)
+	lifecycle, err = loadLifecycle()
+	check(err)
+	if value := envy.Get("LIFECYCLE_EMAILS", ""); value != "" {
+		if lifecycleEmails, err = strconv.ParseBool(value); err != nil {
+			check(errors.Errorf("Bad LIFECYCLE_EMAILS %q. Use true or false", value))
+		}
+	}
+	mainSender, err = loadSender()
+	check(err)
+	reminderTemplate, templateDir = envy.Get("EMAIL_TEMPLATE", ""), envy.Get("TEMPLATE_DIR", "")
+	if reminderTemplate != "" && templateDir != "" {
+		check(errors.New("EMAIL_TEMPLATE and TEMPLATE_DIR can't both be set"))
+	}
+	policy, err = loadReminderPolicy()
+	check(err)
+	planPolicies, err = loadPlanPolicies(reminderTemplate)
+	check(err)
+	// Hubs come from HUBS_FILE, or else from the config file. Without them the environment names the source.
+	var sourceCfg sourceConfig
+	var sourceErr error
+	if hubsFile := envy.Get("HUBS_FILE", ""); hubsFile != "" {
+		configHubs, err = readHubsFile(hubsFile)
+		check(err)
+	} else if len(configHubs) == 0 {
+		sourceCfg, sourceErr = envSource(envy.Get("SOURCE", "sheets"))
+		check(sourceErr)
+	}
+	usesSheets := sourceCfg.Kind == "sheets"
+	hubsHaveStaff := false
+	for _, cfg := range configHubs {
+		usesSheets = usesSheets || cfg.Source == "" || cfg.Source == "sheets"
+		hubsHaveStaff = hubsHaveStaff || cfg.StaffEmails != ""
+	}
+	// Daily summary for the front desk, e.g. STAFF_EMAILS="frontdesk@sprinthub.com.ng;manager@sprinthub.com.ng"
+	check(loadStaffDigest(envy.Get("STAFF_EMAILS", ""), envy.Get("DIGEST_DAYS", strconv.Itoa(defaultDigestDays)),
+		envy.Get("DIGEST_TEMPLATE", defaultDigestTemplate), hubsHaveStaff))
+	if usesSheets {
+		check(setupEnvVars(map[string]*string{"CLIENT_SECRET": &clientSecret}))
+	}
+	serving := !*dryRun && command == ""
+	if serving {
+		check(setupEnvVars(map[string]*string{
+			"PORT":        &port,
+			"CRON_HEADER": &cronHeader,
+		}))
+		mailClient, err = newMailer(envMailConfig())
+		check(err)
+		if p, err := newSendPool(); err != nil {
+			check(err)
+		} else {
+			sendPool = p
+		}
+	}
+	// Only the command line may prompt for an OAuth token; a server has nobody to answer. Nor is it worth
+	// authorizing before the rest of the configuration is fixed.
+	interactive := (*dryRun || command == "validate") && len(problems) == 0
+	if len(configHubs) > 0 {
+		var hubProblems []string
+		hubs, hubProblems = loadHubs(configHubs, interactive, serving)
+		problems = append(problems, hubProblems...)
+	} else if sourceCfg.Kind != "" && sourceErr == nil {
+		subscribers, err = sourceCfg.open(interactive)
+		check(err)
+	}
+	// Email templates for the messages
+	problems = append(problems, loadEmailTemplates(allHubs())...)
+	if len(problems) > 0 {
+		log.Fatalf("Bad configuration:\n  %s\n", strings.Join(problems, "\n  "))
+	}
+	if command == "validate" {
+		var report interface{}
+		failed := false
+		if len(hubs) > 0 {
+			reports := lintHubs(context.Background())
+			for _, r := range reports {
+				failed = failed || r.Error != "" || len(r.Issues) > 0
+			}
+			report = map[string]interface{}{"hubs": reports}
+		} else {
+			r, err := envHub().lintSheet(context.Background())
+			if err != nil {
+				log.Fatalf("%+v\n", err)
+			}
+			report, failed = r, len(r.Issues) > 0
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("%+v\n", err)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(hubs) == 0 {
+		if sentLedger, err = ledger.OpenFileStore(envy.Get("LEDGER_FILE", "reminders.ledger")); err != nil {
+			log.Fatalf("%+v\n", err)
+		}
+		defer sentLedger.Close()
+		deadLetters = &ledger.FileDeadLetters{Path: envy.Get("DEAD_LETTER_FILE", "failed-reminders.json")}
+	}
+	for _, h := range hubs {
+		defer h.sentLedger.Close()
+	}
+	if *dryRun {
+		clock, err := asOfClock(*asOf)
+		if err != nil {
+			log.Fatalf("%+v\n", err)
+		}
+		var plan interface{}
+		if len(hubs) > 0 {
+			plan = map[string]interface{}{"hubs": dryRunHubs(context.Background(), clock)}
+		} else if plan, err = envHub().dryRunPlan(context.Background(), clock); err != nil {
+			log.Fatalf("%+v\n", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(plan); err != nil {
+			log.Fatalf("%+v\n", err)
+		}
+		return
 	}
-	// Email template for the message
-	emailTemplate = template.Must(template.ParseFiles("email-template.html"))
-	mailClient = sendgrid.NewSendClient(sendGridAPIKey)
 	// Create ServeMux and register HTTP handler
-	server := http.NewServeMux()
-	server.HandleFunc("/", cronPingHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", cronPingHandler)
+	mux.HandleFunc("/validate", validateHandler)
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "localhost"
 	}
+	server := &http.Server{Addr: fmt.Sprintf("%s:%s", hostname, port), Handler: mux}
+	var stop context.CancelFunc
+	shutdown, stop = context.WithCancel(context.Background())
+	idle := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Println("Shutting down, finishing emails already being sent")
+		stop()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Printf("%+v\n", err)
+		}
+		close(idle)
+	}()
 	log.Printf("Listening on %s:%s", hostname, port)
-	log.Fatalf("Server crashed with error: %+v\n", http.ListenAndServe(fmt.Sprintf("%s:%s", hostname, port), server))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("Server crashed with error: %+v\n", err)
+	}
+	<-idle
 }
 
 func cronPingHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,89 +339,809 @@ func cronPingHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+	asOf := r.URL.Query().Get("as_of")
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+		clock, err := asOfClock(asOf)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(hubs) > 0 {
+			writeJSON(w, map[string]interface{}{"hubs": dryRunHubs(r.Context(), clock)})
+			return
+		}
+		plan, err := envHub().dryRunPlan(r.Context(), clock)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, plan)
+		return
+	}
+	if asOf != "" {
+		http.Error(w, "as_of can only be used with dry_run=true", http.StatusBadRequest)
+		return
+	}
+	runMu.Lock()
+	defer runMu.Unlock()
+	// Stop handing out sends when the client goes away or the server shuts down
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-shutdown.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if len(hubs) > 0 {
+		// The reports are sent either way, but a failed hub fails the request so that the cron service notices
+		reports := runHubs(ctx)
+		status := http.StatusOK
+		if hubsFailed(reports) {
+			status = http.StatusInternalServerError
+		}
+		writeJSONStatus(w, status, map[string]interface{}{"hubs": reports})
+		return
+	}
+	report, err := envHub().run(ctx, sheetdata.SystemClock)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if len(resp.Values) == 0 {
-		http.Error(w, errors.New("Missing sheets data").Error(), http.StatusInternalServerError)
-		return
+	writeJSON(w, report)
+}
+
+// run reads the hub's subscribers, sends the reminders that are due as of the time given by clock and records
+// the outcomes. Sends stop being handed out once ctx is done. An error means the subscribers could not be read.
+func (h *hub) run(ctx context.Context, clock sheetdata.Clock) (*runReport, error) {
+	plan, err := h.readPlan(ctx, clock)
+	if err != nil {
+		return nil, err
 	}
-	wg := sync.WaitGroup{}
-	for _, row := range resp.Values {
-		wg.Add(1)
-		go func(row []interface{}) {
-			data, err := sheetdata.NewSheetEntry(row)
-			if err != nil {
-				log.Println(errors.WithMessage(err, "Failed to parse data from spreadsheet."))
+	for _, f := range plan.ParseFailures {
+		log.Printf("Row %d: %s\n", f.Row, f.Reason)
+	}
+	for _, s := range plan.Skipped {
+		log.Printf("Not sending email to row %d %s. %s\n", s.Row, s.Email, s.Reason)
+	}
+	report := newRunReport(plan)
+	// Outcome of each reminder, in the order of plan.Recipients. Sends that never started are left empty.
+	outcomes := make([]string, len(plan.Recipients))
+	for _, key := range plan.staleLetters {
+		log.Printf("Dropping failed reminder %s, it no longer needs sending\n", key)
+		if err := h.deadLetters.Remove(key); err != nil {
+			log.Printf("%+v\n", err)
+		}
+	}
+	for _, letter := range plan.expiredLetters {
+		log.Printf("Giving up on failed reminder %s after %d attempts since %s: %s\n", letter.Key, letter.Attempts,
+			letter.Since().Format(time.RFC3339), letter.Error)
+		if err := h.deadLetters.Remove(letter.Key); err != nil {
+			log.Printf("%+v\n", err)
+		}
+	}
+	dropped := sendPool.Run(ctx, len(plan.Recipients), func(i int) {
+		rcpt := plan.Recipients[i]
+		// A panic on a pool worker would end the process, so it only fails this send
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Sending to row %d panicked: %v\n%s", rcpt.Row, p, debug.Stack())
+				err := errors.Errorf("Sending panicked: %v", p)
+				report.failed(rcpt, err)
+				outcomes[i] = "failed: " + err.Error()
 			}
-			// Determine whether there's between 0 and 24 hours left
-			if shouldSendEmail(data.DaysLeft()) {
-				// Send email notification
-				if err := sendEmail(data); err != nil {
-					log.Printf("%+v\n%+v\n", err, data)
-					wg.Done()
-					return
+		}()
+		data := rcpt.entry
+		key := rcpt.key()
+		// Send email notification
+		var messageID string
+		err := retryPolicy.Do(ctx, func() (err error) {
+			messageID, err = h.sendEmail(data, rcpt.reminder)
+			return err
+		})
+		if err != nil {
+			log.Printf("%+v\n%+v\n", err, data)
+			report.failed(rcpt, err)
+			outcomes[i] = "failed: " + err.Error()
+			if !permanentFailure(err) {
+				h.deadLetter(rcpt, err.Error(), true, plan.clock)
+			} else if rcpt.Retry {
+				// Sending again won't help, so the failure is only recorded in the status column
+				if err := h.deadLetters.Remove(key); err != nil {
+					log.Printf("%+v\n", err)
 				}
-				log.Printf("Sent email to %s at %s\n", data.FullName(), data.Email)
-			} else {
-				log.Printf("Not sending email to %s. Days left: %d\n", data.Email, data.DaysLeft())
 			}
-			wg.Done()
-		}(row)
+			return
+		}
+		report.sent()
+		outcomes[i] = "sent"
+		log.Printf("Sent email to %s at %s\n", data.FullName(), data.Email)
+		entry := ledger.Entry{Key: key, SentAt: plan.clock.Now().UTC(), MessageID: messageID}
+		if err := h.sentLedger.Record(entry); err != nil {
+			log.Printf("%+v\n", errors.WithMessage(err, "Failed to record email to "+data.Email))
+		}
+		if rcpt.Retry {
+			if err := h.deadLetters.Remove(key); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+	})
+	report.EmailsCancelled = len(dropped)
+	if len(dropped) > 0 {
+		log.Printf("Run cancelled before %d emails were sent: %v\n", len(dropped), ctx.Err())
+	}
+	for _, i := range dropped {
+		h.deadLetter(plan.Recipients[i], "Run cancelled before sending", false, plan.clock)
+	}
+	if err := h.writeStatus(ctx, plan, outcomes); err != nil {
+		log.Printf("%+v\n", err)
+		report.StatusError = err.Error()
+	}
+	if report.DigestSent, err = h.sendStaffDigest(ctx, plan); err != nil {
+		log.Printf("%+v\n", err)
+		report.DigestError = err.Error()
 	}
-	wg.Wait()
-	w.WriteHeader(http.StatusOK)
+	log.Printf("Run finished%s. Rows read: %d, parse failures: %d, sent: %d, skipped: %d, send failures: %d "+
+		"(%d rejected by the provider), cancelled: %d\n", h.logName(),
+		report.RowsRead, len(report.ParseFailures), report.EmailsSent, report.EmailsSkipped, len(report.SendFailures),
+		report.ProviderRejections, report.EmailsCancelled)
+	return report, nil
 }
 
-// shouldSendEmail determines whether a hub user should be emailed
-func shouldSendEmail(daysToExpiry int) bool {
-	if daysToExpiry == 1 || daysToExpiry == 3 || daysToExpiry == 7 {
-		return true
+// logName names the hub in log lines, e.g. " for hub Lekki". It is empty for the hub configured by the environment.
+func (h *hub) logName() string {
+	if h.name == "" {
+		return ""
 	}
-	return false
+	return " for hub " + h.name
 }
 
-func sendEmail(data sheetdata.SheetEntry) error {
-	from := mail.NewEmail(messageSender, fromEmail)
-	to := mail.NewEmail(data.FirstName, data.Email)
-	text := fmt.Sprintf(messageText, strconv.Itoa(data.DaysLeft()))
+// writeJSON responds with v encoded as JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+// writeJSONStatus responds with v as JSON and the given status code
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("%+v\n", err)
+	}
+}
+
+// validateHandler responds with a report of the problems in the subscribers sheet, without sending anything
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-SPRINTHUB-CRON") != cronHeader {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if len(hubs) > 0 {
+		writeJSON(w, map[string]interface{}{"hubs": lintHubs(r.Context())})
+		return
+	}
+	report, err := envHub().lintSheet(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// lintSheet reads the sheet and checks every row for problems staff should fix before reminders go out
+func (h *hub) lintSheet(ctx context.Context) (*lint.Report, error) {
+	values, err := h.subscribers.Rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, err := source.StartOf(h.subscribers)
+	if err != nil {
+		return nil, err
+	}
+	opts := lintOptions
+	opts.Parser = sheetdata.Options{
+		Aliases:     headerAliases,
+		DateLayouts: dateLayouts,
+		FirstColumn: start.Column,
+		Location:    hubLocation,
+	}
+	opts.FirstRow = start.Row
+	for plan := range h.planPolicies {
+		opts.Plans = append(opts.Plans, plan)
+	}
+	sort.Strings(opts.Plans)
+	return lint.Sheet(values, opts)
+}
+
+// deadLetter saves a reminder that could not be sent, so the next run retries it first. If the reminder was attempted,
+// rather than cancelled before sending, it counts as one more failed attempt.
+func (h *hub) deadLetter(rcpt recipient, reason string, attempted bool, clock sheetdata.Clock) {
+	now := clock.Now().UTC()
+	letter := ledger.DeadLetter{Key: rcpt.key(), Error: reason, FailedAt: now, FirstFailedAt: now}
+	if rcpt.letter != nil {
+		letter.Attempts, letter.FirstFailedAt = rcpt.letter.Attempts, rcpt.letter.Since()
+	}
+	if attempted {
+		letter.Attempts++
+	}
+	if err := h.deadLetters.Add(letter); err != nil {
+		log.Printf("%+v\n", errors.WithMessage(err, "Failed to save the failed reminder to "+rcpt.Email))
+	}
+}
+
+// permanentFailure reports whether sending a reminder failed in a way that sending it on a later run won't fix,
+// such as a 400 or 401 from the mail provider or a permanent SMTP reply
+func permanentFailure(err error) bool {
+	return retry.Permanent(err) || mailer.Rejected(err)
+}
+
+// writeStatus records the date, reminder and outcome of each send in the sheet's reminder status column,
+// if the sheet has one and the source can be written to
+func (h *hub) writeStatus(ctx context.Context, plan *runPlan, outcomes []string) error {
+	writer, ok := h.subscribers.(source.StatusWriter)
+	if !ok || !plan.hasStatusColumn {
+		return nil
+	}
+	today := plan.clock.Now().In(hubLocation).Format("2006-01-02")
+	updates := make([]source.StatusUpdate, 0, len(plan.Recipients))
+	for i, rcpt := range plan.Recipients {
+		if outcomes[i] == "" {
+			// Never sent, so the row keeps its last status
+			continue
+		}
+		updates = append(updates, source.StatusUpdate{
+			Row:    rcpt.Row,
+			Column: plan.statusColumn,
+			Value:  fmt.Sprintf("%s: %s reminder %s", today, reminderName(rcpt.reminder.Offset), outcomes[i]),
+		})
+	}
+	return writer.WriteStatus(ctx, updates)
+}
+
+// reminderName describes a reminder offset for people, e.g. "3 days left" or "expired 1 day ago"
+func reminderName(offset int) string {
+	switch {
+	case offset == 0:
+		return "expiry day"
+	case offset < 0:
+		return "expired " + pluralDays(offset) + " ago"
+	}
+	return pluralDays(offset) + " left"
+}
+
+// readPlan reads the subscribers and plans the reminders to send as of the time given by clock
+func (h *hub) readPlan(ctx context.Context, clock sheetdata.Clock) (*runPlan, error) {
+	values, err := h.subscribers.Rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, err := source.StartOf(h.subscribers)
+	if err != nil {
+		return nil, err
+	}
+	return h.planReminders(values, start, clock)
+}
+
+// asOfClock returns the clock a dry run plans with: today, or the day asOf names (YYYY-MM-DD) in the hub's time zone.
+func asOfClock(asOf string) (sheetdata.Clock, error) {
+	if asOf == "" {
+		return sheetdata.SystemClock, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", asOf, hubLocation)
+	if err != nil {
+		return nil, errors.Wrap(err, "Bad as-of date")
+	}
+	return sheetdata.FixedClock(day), nil
+}
+
+// dryRunPlan reads the sheet and returns the reminders a run would send on the clock's day without sending them.
+func (h *hub) dryRunPlan(ctx context.Context, clock sheetdata.Clock) (*runPlan, error) {
+	plan, err := h.readPlan(ctx, clock)
+	if err != nil {
+		return nil, err
+	}
+	plan.DryRun = true
+	if len(h.staffEmails) > 0 {
+		plan.Digest = newStaffDigest(plan, digestDays)
+	}
+	return plan, nil
+}
+
+// lifecycleSubjects are the default subjects of the lifecycle emails, by stage
+var lifecycleSubjects = map[string]string{
+	reminder.StageExpired:     messageSubjectExpired,
+	reminder.StageGraceEnding: messageSubjectGraceEnding,
+	reminder.StageWinBack:     messageSubjectWinBack,
+}
+
+// loadReminderPolicy builds the reminder schedule from REMINDER_OFFSETS and the lifecycle emails if LIFECYCLE_EMAILS
+// is on. The subject and template of each reminder can be set with REMINDER_SUBJECT_<N> and REMINDER_TEMPLATE_<N>,
+// where N is the offset, e.g. 7 or NEG_1 for -1.
+func loadReminderPolicy() (reminder.Policy, error) {
+	return newReminderPolicy("", envOffsets(), reminderTemplate)
+}
+
+// envOffsets returns the default reminder offsets, REMINDER_OFFSETS
+func envOffsets() string {
+	return envy.Get("REMINDER_OFFSETS", reminder.DefaultOffsets)
+}
+
+// loadPlanPolicies builds the reminder schedule of each plan in PLANS, e.g. "daily,weekly,monthly,annual".
+// PLAN_<NAME>_OFFSETS replaces REMINDER_OFFSETS and PLAN_<NAME>_CHANNELS lists the channels, "email" by default
+// or "none". Subscriptions on other plans, or without one, follow the default schedule. Reminders use tmpl unless
+// a template is configured for them.
+func loadPlanPolicies(tmpl string) (map[string]reminder.Policy, error) {
+	policies := map[string]reminder.Policy{}
+	for _, name := range strings.Split(envy.Get("PLANS", ""), ",") {
+		plan := sheetdata.NormalisePlan(name)
+		if plan == "" {
+			continue
+		}
+		prefix := planEnvPrefix(plan)
+		p, err := newReminderPolicy(plan, envy.Get(prefix+"OFFSETS", envOffsets()), tmpl)
+		if err != nil {
+			return nil, err
+		}
+		if p.Channels, err = reminder.ParseChannels(envy.Get(prefix+"CHANNELS", reminder.ChannelEmail)); err != nil {
+			return nil, errors.WithMessage(err, "Bad "+prefix+"CHANNELS value")
+		}
+		policies[plan] = p
+	}
+	return policies, nil
+}
+
+// planEnvPrefix returns the prefix of the settings of a plan, e.g. "PLAN_ANNUAL_PLUS_" for "annual plus"
+func planEnvPrefix(plan string) string {
+	return "PLAN_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, plan) + "_"
+}
+
+// policyFor returns the reminder schedule of a subscriber's plan, or the default one for an unknown plan
+func (h *hub) policyFor(data sheetdata.SheetEntry) reminder.Policy {
+	if p, ok := h.planPolicies[data.Plan]; ok {
+		return p
+	}
+	return h.policy
+}
+
+// newReminderPolicy builds a reminder schedule from a list of offsets. The settings of a plan, PLAN_<NAME>_SUBJECT_<N>,
+// PLAN_<NAME>_TEMPLATE_<N> and PLAN_<NAME>_TEMPLATE for all of its reminders, take precedence over the general
+// ones. Reminders without a template use tmpl, or their stage's template if tmpl is empty. plan is empty for the
+// default schedule.
+func newReminderPolicy(plan, offsetList, tmpl string) (reminder.Policy, error) {
+	offsets, err := reminder.ParseOffsets(offsetList)
+	if err != nil {
+		if plan != "" {
+			return reminder.Policy{}, errors.WithMessage(err, "Bad "+planEnvPrefix(plan)+"OFFSETS value")
+		}
+		return reminder.Policy{}, errors.WithMessage(err, "Bad REMINDER_OFFSETS value")
+	}
+	reminders := make([]reminder.Reminder, 0, len(offsets))
+	scheduled := map[int]bool{}
+	for _, offset := range offsets {
+		scheduled[offset] = true
+		subject := messageSubject
+		if offset == 0 {
+			subject = messageSubjectToday
+		} else if offset < 0 {
+			subject = messageSubjectAfter
+		}
+		reminders = append(reminders, reminder.Reminder{Offset: offset, Subject: subject})
+	}
+	if lifecycleEmails {
+		for _, r := range lifecycle.Reminders() {
+			if scheduled[r.Offset] {
+				setting := "REMINDER_OFFSETS"
+				if plan != "" {
+					setting = planEnvPrefix(plan) + "OFFSETS"
+				}
+				return reminder.Policy{}, errors.Errorf("Offset %d in %s clashes with the %s lifecycle email. "+
+					"Remove it or turn off LIFECYCLE_EMAILS", r.Offset, setting, r.Stage)
+			}
+			reminders = append(reminders, r)
+		}
+	}
+	for i, r := range reminders {
+		if r.Stage != "" {
+			r.Subject = lifecycleSubjects[r.Stage]
+		}
+		key := reminder.OffsetKey(r.Offset)
+		r.Subject = envy.Get("REMINDER_SUBJECT_"+key, r.Subject)
+		r.Template = envy.Get("REMINDER_TEMPLATE_"+key, tmpl)
+		if plan != "" {
+			prefix := planEnvPrefix(plan)
+			r.Subject = envy.Get(prefix+"SUBJECT_"+key, r.Subject)
+			r.Template = envy.Get(prefix+"TEMPLATE_"+key, envy.Get(prefix+"TEMPLATE", r.Template))
+		}
+		if r.Template == "" {
+			r.Template = stageTemplate(r)
+		}
+		reminders[i] = r
+	}
+	return reminder.NewPolicy(reminders...), nil
+}
+
+// loadSender reads the sender of the emails from SENDER_NAME, FROM_EMAIL and REPLY_TO
+func loadSender() (sender, error) {
+	s := sender{
+		Name:    envy.Get("SENDER_NAME", messageSender),
+		Email:   envy.Get("FROM_EMAIL", fromEmail),
+		ReplyTo: envy.Get("REPLY_TO", ""),
+	}
+	if s.Name == "" {
+		s.Name = messageSender
+	}
+	if s.Email == "" {
+		s.Email = fromEmail
+	}
+	var err error
+	if s.Email, err = sheetdata.NormaliseEmail(s.Email); err != nil {
+		return s, errors.WithMessage(err, "Bad FROM_EMAIL value")
+	}
+	if s.ReplyTo == "" {
+		return s, nil
+	}
+	s.ReplyTo, err = sheetdata.NormaliseEmail(s.ReplyTo)
+	return s, errors.WithMessage(err, "Bad REPLY_TO value")
+}
+
+// loadLifecycle reads EXPIRING_DAYS, GRACE_DAYS and CHURN_DAYS
+func loadLifecycle() (reminder.Lifecycle, error) {
+	l := reminder.DefaultLifecycle
+	for envVar, dest := range map[string]*int{
+		"EXPIRING_DAYS": &l.ExpiringDays,
+		"GRACE_DAYS":    &l.GraceDays,
+		"CHURN_DAYS":    &l.ChurnDays,
+	} {
+		value := envy.Get(envVar, "")
+		if value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			return l, errors.Errorf("Bad %s %q. It must be a whole number of days", envVar, value)
+		}
+		*dest = days
+	}
+	return l, errors.WithMessage(l.Validate(), "Bad subscription lifecycle")
+}
+
+// pluralDays formats a number of days, e.g. "1 day" or "3 days"
+func pluralDays(days int) string {
+	if days < 0 {
+		days = -days
+	}
+	if days == 1 {
+		return "1 day"
+	}
+	return strconv.Itoa(days) + " days"
+}
+
+// emailData holds the values available to email templates
+type emailData struct {
+	// The subscriber's row, e.g. .FirstName, .LastName, .Email, .EndDate and .Plan
+	sheetdata.SheetEntry
+	TimeLeft string
+	DaysLeft int
+	Expired  bool
+	// Stage is the lifecycle email being sent, e.g. "grace_ending", or empty for a plain reminder
+	Stage string
+	// GraceEnds is the last day of the grace period, e.g. "8 May 2024", and GraceDays its length
+	GraceEnds string
+	GraceDays int
+	// Brand is the name, logo and contact details of the hub
+	Brand brand
+}
+
+// sendEmail sends the reminder r to a subscriber and returns the mail provider's ID for the message
+func (h *hub) sendEmail(data sheetdata.SheetEntry, r reminder.Reminder) (string, error) {
+	values, text := h.emailData(data, r)
 	msgBytes := bytes.NewBuffer([]byte{})
-	daysLeft := strconv.Itoa(data.DaysLeft()) + " day"
-	if data.DaysLeft() > 1 {
-		daysLeft = daysLeft + "s"
-	}
-	err := emailTemplate.Execute(msgBytes, struct {
-		FirstName, TimeLeft string
-	}{
-		FirstName: data.FirstName,
-		TimeLeft:  daysLeft,
+	if err := emailTemplates[r.Template].Execute(msgBytes, values); err != nil {
+		return "", errors.WithMessage(err, "Cannot execute HTML template.")
+	}
+	return h.mail.Send(mailer.Message{
+		FromName:  h.sender.Name,
+		FromEmail: h.sender.Email,
+		ReplyTo:   h.sender.ReplyTo,
+		ToName:    data.FirstName,
+		ToEmail:   data.Email,
+		Cc:        data.Emails[1:],
+		Subject:   r.Subject,
+		Text:      text,
+		HTML:      msgBytes.String(),
 	})
+}
+
+// emailData returns the values for the template of reminder r to a subscriber and the plain text of the email.
+// They count the days left on the day the email is sent, which differs from the reminder's offset when a failed
+// reminder is retried on a later day.
+func (h *hub) emailData(data sheetdata.SheetEntry, r reminder.Reminder) (emailData, string) {
+	days := data.DaysLeft()
+	daysLeft := pluralDays(days)
+	graceEnds := data.EndDate.AddDate(0, 0, lifecycle.GraceDays)
+	name := h.brand.Name
+	text := fmt.Sprintf(messageText, name, daysLeft)
+	switch {
+	case r.Stage == reminder.StageExpired && lifecycle.GraceDays > 0:
+		text = fmt.Sprintf(messageTextExpiredGrace, name, graceEnds.Format("2 January 2006"))
+	case r.Stage == reminder.StageExpired:
+		text = fmt.Sprintf(messageTextExpired, name)
+	case r.Stage == reminder.StageGraceEnding:
+		text = fmt.Sprintf(messageTextGraceEnding, name, pluralDays(days+lifecycle.GraceDays), graceEnds.Format("2 January 2006"))
+	case r.Stage == reminder.StageWinBack:
+		text = fmt.Sprintf(messageTextWinBack, name, daysLeft)
+	case days == 0:
+		text = fmt.Sprintf(messageTextToday, name)
+	case days < 0:
+		text = fmt.Sprintf(messageTextAfter, name, daysLeft)
+	}
+	return emailData{
+		SheetEntry: data,
+		TimeLeft:   daysLeft,
+		DaysLeft:   days,
+		Expired:    days < 0,
+		Stage:      r.Stage,
+		GraceEnds:  graceEnds.Format("2 January 2006"),
+		GraceDays:  lifecycle.GraceDays,
+		Brand:      h.brand,
+	}, text
+}
+
+// envSource reads where subscribers come from in a single hub deployment. kind is SOURCE: "sheets" (the default),
+// "csv" or "xlsx".
+func envSource(kind string) (sourceConfig, error) {
+	cfg := sourceConfig{Kind: kind}
+	switch kind {
+	case "sheets":
+		if err := setupEnvVars(map[string]*string{
+			"SPREADSHEET_ID": &spreadsheetID,
+			"READ_RANGE":     &readRange,
+		}); err != nil {
+			return cfg, err
+		}
+		cfg.SpreadsheetID, cfg.ReadRange = spreadsheetID, readRange
+	case "csv", "xlsx":
+		if err := setupEnvVars(map[string]*string{"SOURCE_FILE": &cfg.File}); err != nil {
+			return cfg, err
+		}
+		cfg.XLSXSheet = envy.Get("XLSX_SHEET", "")
+	default:
+		return cfg, errors.Errorf("Unknown SOURCE %q. Use sheets, csv or xlsx", kind)
+	}
+	return cfg, nil
+}
+
+// sourceConfig says where subscribers are read from
+type sourceConfig struct {
+	// Kind is "sheets", "csv" or "xlsx"
+	Kind                     string
+	SpreadsheetID, ReadRange string
+	// File and XLSXSheet are for the file sources
+	File, XLSXSheet string
+}
+
+// open creates the source. The sheets source may ask for an OAuth token on the terminal if interactive is true.
+func (cfg sourceConfig) open(interactive bool) (source.SubscriberSource, error) {
+	switch cfg.Kind {
+	case "sheets":
+		service, err := sheetsService(interactive)
+		if err != nil {
+			return nil, err
+		}
+		return &source.Sheets{
+			Service:           service,
+			SpreadsheetID:     cfg.SpreadsheetID,
+			Range:             cfg.ReadRange,
+			ValueRenderOption: envy.Get("SHEETS_VALUE_RENDER_OPTION", "UNFORMATTED_VALUE"),
+			Retry:             retryPolicy,
+		}, nil
+	case "csv":
+		return &source.CSV{Path: cfg.File}, nil
+	case "xlsx":
+		return &source.XLSX{Path: cfg.File, Sheet: cfg.XLSXSheet}, nil
+	}
+	return nil, errors.Errorf("Unknown source %q. Use sheets, csv or xlsx", cfg.Kind)
+}
+
+// sheetsService connects to the Sheets API with CLIENT_SECRET. The connection is shared by every hub.
+func sheetsService(interactive bool) (*sheets.Service, error) {
+	if srv != nil {
+		return srv, nil
+	}
+	if err := setupEnvVars(map[string]*string{"CLIENT_SECRET": &clientSecret}); err != nil {
+		return nil, err
+	}
+	tokenStore, err := newTokenStore()
 	if err != nil {
-		return errors.WithMessage(err, "Cannot execute HTML template.")
+		return nil, err
 	}
-	message := mail.NewSingleEmail(from, messageSubject, to, text, msgBytes.String())
-	message.SetMailSettings(&mail.MailSettings{
-		SandboxMode: &mail.Setting{
-			Enable: &enableSandboxMode,
-		},
+	srv = sheetsservice.NewSheetsService([]byte(clientSecret), sheetsservice.Options{
+		Subject:     envy.Get("DELEGATED_USER", ""),
+		Interactive: interactive,
+		TokenStore:  tokenStore,
 	})
-	_, err = mailClient.Send(message)
+	if srv == nil {
+		return nil, errors.New("Sheets service configuration failed")
+	}
+	return srv, nil
+}
+
+// newTokenStore creates the store for the OAuth token named by TOKEN_STORE: "file" (the default) keeps it at
+// TOKEN_FILE, and "postgres" in the database at DATABASE_URL, which outlives a Heroku dyno. The token is encrypted
+// if TOKEN_ENCRYPTION_KEY holds a base64 encoded AES key.
+func newTokenStore() (sheetsservice.TokenStore, error) {
+	var key []byte
+	if encodedKey := envy.Get("TOKEN_ENCRYPTION_KEY", ""); encodedKey != "" {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(encodedKey); err != nil {
+			return nil, errors.Wrap(err, "TOKEN_ENCRYPTION_KEY is not valid base64")
+		}
+	}
+	switch kind := envy.Get("TOKEN_STORE", "file"); kind {
+	case "file":
+		path := envy.Get("TOKEN_FILE", "token.json")
+		if key == nil {
+			return sheetsservice.FileTokenStore{Path: path}, nil
+		}
+		return sheetsservice.NewEncryptedFileTokenStore(path, key)
+	case "postgres":
+		var databaseURL string
+		if err := setupEnvVars(map[string]*string{"DATABASE_URL": &databaseURL}); err != nil {
+			return nil, err
+		}
+		return sheetsservice.NewPostgresTokenStore(databaseURL, "sheets", key)
+	default:
+		return nil, errors.Errorf("Unknown token store %q. Use file or postgres", kind)
+	}
+}
+
+// mailConfig is how emails are sent. A hub's mail settings fall back to the ones of the environment.
+type mailConfig struct {
+	// Backend is "sendgrid", "smtp" or "file"
+	Backend        string `json:"backend"`
+	SendGridAPIKey string `json:"sendgrid_api_key"`
+	SMTPAddr       string `json:"smtp_addr"`
+	SMTPUsername   string `json:"smtp_username"`
+	SMTPPassword   string `json:"smtp_password"`
+	Dir            string `json:"dir"`
+}
+
+// envMailConfig reads MAILER, SENDGRID_API_KEY, SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD and MAIL_DIR
+func envMailConfig() mailConfig {
+	return mailConfig{
+		Backend:        envy.Get("MAILER", "sendgrid"),
+		SendGridAPIKey: envy.Get("SENDGRID_API_KEY", ""),
+		SMTPAddr:       envy.Get("SMTP_ADDR", ""),
+		SMTPUsername:   envy.Get("SMTP_USERNAME", ""),
+		SMTPPassword:   envy.Get("SMTP_PASSWORD", ""),
+		Dir:            envy.Get("MAIL_DIR", "mail"),
+	}
+}
+
+// withDefaults fills the settings m leaves out from defaults
+func (m mailConfig) withDefaults(defaults mailConfig) mailConfig {
+	for _, field := range []struct{ value, fallback *string }{
+		{&m.Backend, &defaults.Backend},
+		{&m.SendGridAPIKey, &defaults.SendGridAPIKey},
+		{&m.SMTPAddr, &defaults.SMTPAddr},
+		{&m.SMTPUsername, &defaults.SMTPUsername},
+		{&m.SMTPPassword, &defaults.SMTPPassword},
+		{&m.Dir, &defaults.Dir},
+	} {
+		if *field.value == "" {
+			*field.value = *field.fallback
+		}
+	}
+	return m
+}
+
+// newMailer creates the mail backend named by cfg.Backend: "sendgrid" (the default), "smtp" or "file"
+func newMailer(cfg mailConfig) (mailer.Mailer, error) {
+	switch cfg.Backend {
+	case "sendgrid":
+		if cfg.SendGridAPIKey == "" {
+			return nil, errors.Errorf(ErrFmtMissingEnvVar, "SENDGRID_API_KEY")
+		}
+		return mailer.NewSendGrid(cfg.SendGridAPIKey, enableSandboxMode), nil
+	case "smtp":
+		if cfg.SMTPAddr == "" {
+			return nil, errors.Errorf(ErrFmtMissingEnvVar, "SMTP_ADDR")
+		}
+		return mailer.NewSMTP(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword)
+	case "file":
+		return mailer.NewFile(cfg.Dir)
+	}
+	return nil, errors.Errorf("Unknown MAILER %q. Use sendgrid, smtp or file", cfg.Backend)
+}
+
+// loadLintOptions reads how far in the past or future end dates may be before validation reports them,
+// from LINT_MAX_PAST_DAYS and LINT_MAX_FUTURE_DAYS
+func loadLintOptions() (lint.Options, error) {
+	var opts lint.Options
+	for envVar, dest := range map[string]*int{
+		"LINT_MAX_PAST_DAYS":   &opts.MaxPastDays,
+		"LINT_MAX_FUTURE_DAYS": &opts.MaxFutureDays,
+	} {
+		value := envy.Get(envVar, "")
+		if value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			return opts, errors.Errorf("Bad %s %q. It must be a whole number of days above 0", envVar, value)
+		}
+		*dest = days
+	}
+	return opts, nil
+}
+
+// loadRetryPolicy reads RETRY_ATTEMPTS, RETRY_BASE_DELAY and RETRY_MAX_DELAY, e.g. "4", "1s" and "30s"
+func loadRetryPolicy() (retry.Policy, error) {
+	p := retry.DefaultPolicy
+	attempts, err := strconv.Atoi(envy.Get("RETRY_ATTEMPTS", strconv.Itoa(retry.DefaultAttempts)))
+	if err != nil || attempts < 1 {
+		return p, errors.Errorf("Bad RETRY_ATTEMPTS %q. It must be a whole number above 0", envy.Get("RETRY_ATTEMPTS", ""))
+	}
+	p.Attempts = attempts
+	if p.Base, err = time.ParseDuration(envy.Get("RETRY_BASE_DELAY", retry.DefaultBase.String())); err != nil {
+		return p, errors.Wrap(err, "Bad RETRY_BASE_DELAY value")
+	}
+	if p.Max, err = time.ParseDuration(envy.Get("RETRY_MAX_DELAY", retry.DefaultMax.String())); err != nil {
+		return p, errors.Wrap(err, "Bad RETRY_MAX_DELAY value")
+	}
+	return p, nil
+}
+
+// loadDeadLetterLimits reads how many runs may fail to send a reminder, DEAD_LETTER_ATTEMPTS, and how long after the
+// first failure it may still be retried, DEAD_LETTER_MAX_AGE
+func loadDeadLetterLimits() (int, time.Duration, error) {
+	attempts, err := strconv.Atoi(envy.Get("DEAD_LETTER_ATTEMPTS", strconv.Itoa(defaultDeadLetterAttempts)))
+	if err != nil || attempts < 1 {
+		return 0, 0, errors.Errorf("Bad DEAD_LETTER_ATTEMPTS %q. It must be a whole number above 0", envy.Get("DEAD_LETTER_ATTEMPTS", ""))
+	}
+	maxAge, err := time.ParseDuration(envy.Get("DEAD_LETTER_MAX_AGE", defaultDeadLetterMaxAge.String()))
 	if err != nil {
-		return errors.WithMessage(err, "Message sending failed.")
+		return 0, 0, errors.Wrap(err, "Bad DEAD_LETTER_MAX_AGE value")
 	}
-	//log.Printf("Response: %v\n", response)
-	return nil
+	return attempts, maxAge, nil
 }
 
+// newSendPool creates the pool of senders from SEND_CONCURRENCY and SEND_RATE (emails started per second, 0 for no limit)
+func newSendPool() (*pool.Pool, error) {
+	workers, err := strconv.Atoi(envy.Get("SEND_CONCURRENCY", strconv.Itoa(defaultSendConcurrency)))
+	if err != nil || workers < 1 {
+		return nil, errors.Errorf("Bad SEND_CONCURRENCY %q. It must be a whole number above 0", envy.Get("SEND_CONCURRENCY", ""))
+	}
+	rate, err := strconv.ParseFloat(envy.Get("SEND_RATE", strconv.Itoa(defaultSendRate)), 64)
+	if err != nil || rate < 0 {
+		return nil, errors.Errorf("Bad SEND_RATE %q. It must be a number of emails per second, or 0 for no limit", envy.Get("SEND_RATE", ""))
+	}
+	return pool.New(workers, rate), nil
+}
+
+// setupEnvVars reads required environment variables into vars. All the missing ones are named in the error.
 func setupEnvVars(vars map[string]*string) error {
+	var missing []string
 	for envVar, dest := range vars {
 		val, err := envy.MustGet(envVar)
 		if err != nil {
-			return errors.Errorf(ErrFmtMissingEnvVar, envVar)
+			missing = append(missing, envVar)
+			continue
 		}
 		*dest = val
 	}
-	return nil
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return errors.Errorf(ErrFmtMissingEnvVar, missing[0])
+	}
+	sort.Strings(missing)
+	return errors.Errorf(ErrFmtMissingEnvVars, strings.Join(missing, ", "))
 }
@@ -1,23 +1,410 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
 
-func TestShouldSendEmail(t *testing.T)  {
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/lint"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/retry"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
+	"github.com/gobuffalo/envy"
+)
+
+func TestLoadReminderPolicy(t *testing.T) {
+	testCases := map[string]struct {
+		Offsets         string
+		Lifecycle       bool
+		Value           int
+		ExpectError     bool
+		ExpectedResult  bool
+		ExpectedSubject string
+	}{
+		"Zero should be false by default":           {Value: 0, ExpectedResult: false},
+		"Equal to 1 should be true by default":      {Value: 1, ExpectedResult: true, ExpectedSubject: messageSubject},
+		"Equal to 3 should be true by default":      {Value: 3, ExpectedResult: true, ExpectedSubject: messageSubject},
+		"Equal to 7 should be true by default":      {Value: 7, ExpectedResult: true, ExpectedSubject: "One week left"},
+		"Other negative should be false by default": {Value: -2, ExpectedResult: false},
+		"No expired email by default":               {Value: -1, ExpectedResult: false},
+		"No win back email by default":              {Value: -30, ExpectedResult: false},
+		"Expired email when turned on":              {Lifecycle: true, Value: -1, ExpectedResult: true, ExpectedSubject: messageSubjectExpired},
+		"Grace ending email when turned on":         {Lifecycle: true, Value: -5, ExpectedResult: true, ExpectedSubject: messageSubjectGraceEnding},
+		"Win back email when turned on":             {Lifecycle: true, Value: -30, ExpectedResult: true, ExpectedSubject: messageSubjectWinBack},
+		"Lifecycle email clashing with offset":      {Offsets: "7,-1", Lifecycle: true, ExpectError: true},
+		"Any other number should be false":          {Value: 20, ExpectedResult: false},
+		"Configured 14 should be true":              {Offsets: "14,7,3,1,0,-1,-3", Value: 14, ExpectedResult: true, ExpectedSubject: messageSubject},
+		"Configured zero should be true":            {Offsets: "14,7,3,1,0,-1,-3", Value: 0, ExpectedResult: true, ExpectedSubject: messageSubjectToday},
+		"Configured negative should be true":        {Offsets: "14,7,3,1,0,-1,-3", Value: -3, ExpectedResult: true, ExpectedSubject: messageSubjectAfter},
+		"Configured -1 is a plain reminder":         {Offsets: "14,7,3,1,0,-1,-3", Value: -1, ExpectedResult: true, ExpectedSubject: messageSubjectAfter},
+		"Unconfigured negative should be false":     {Offsets: "14,7,3,1,0,-1,-3", Value: -2, ExpectedResult: false},
+	}
+	defer func() { lifecycleEmails = false }()
+	for testcase, data := range testCases {
+		envy.Temp(func() {
+			envy.Set("REMINDER_SUBJECT_7", "One week left")
+			if data.Offsets != "" {
+				envy.Set("REMINDER_OFFSETS", data.Offsets)
+			}
+			lifecycleEmails = data.Lifecycle
+			p, err := loadReminderPolicy()
+			if data.ExpectError {
+				if err == nil {
+					t.Errorf("%s\n\tExpected an error\n", testcase)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s\n\tUnexpected error: %+v\n", testcase, err)
+			}
+			r, ok := p.Reminder(data.Value)
+			if ok != data.ExpectedResult {
+				t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.ExpectedResult, ok)
+			}
+			if ok && (r.Subject != data.ExpectedSubject || r.Template != defaultTemplate) {
+				t.Errorf("%s\n\tExpected subject: %q, Got: %q\n", testcase, data.ExpectedSubject, r.Subject)
+			}
+		})
+	}
+}
+
+func TestLoadPlanPolicies(t *testing.T) {
+	envy.Temp(func() {
+		envy.Set("PLANS", "Daily, weekly,Annual Plus")
+		envy.Set("PLAN_DAILY_CHANNELS", "none")
+		envy.Set("PLAN_WEEKLY_OFFSETS", "2,0")
+		envy.Set("PLAN_WEEKLY_TEMPLATE", "weekly.html")
+		envy.Set("PLAN_ANNUAL_PLUS_OFFSETS", "30,7")
+		envy.Set("PLAN_ANNUAL_PLUS_SUBJECT_30", "A month left")
+		policies, err := loadPlanPolicies(defaultTemplate)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		if len(policies) != 3 || policies["daily"].Sends(reminder.ChannelEmail) {
+			t.Errorf("Expected 3 plans and no emails for daily, Got: %+v", policies)
+		}
+		if r, ok := policies["weekly"].Reminder(2); !ok || r.Template != "weekly.html" {
+			t.Errorf("Expected the weekly 2 day reminder to use weekly.html, Got: %v %+v", ok, r)
+		}
+		if _, ok := policies["weekly"].Reminder(7); ok {
+			t.Errorf("Expected no 7 day reminder for the weekly plan")
+		}
+		if r, ok := policies["annual plus"].Reminder(30); !ok || r.Subject != "A month left" || r.Template != defaultTemplate {
+			t.Errorf("Expected the annual plus 30 day reminder, Got: %v %+v", ok, r)
+		}
+
+		envy.Set("PLAN_WEEKLY_CHANNELS", "pigeon")
+		if _, err := loadPlanPolicies(defaultTemplate); err == nil || !strings.Contains(err.Error(), "PLAN_WEEKLY_CHANNELS") {
+			t.Errorf("Expected an error naming PLAN_WEEKLY_CHANNELS, Got: %v", err)
+		}
+	})
+}
+
+func TestNewTokenStore(t *testing.T) {
 	testCases := map[string]struct {
-		Value          int
-		ExpectedResult bool
+		Env      map[string]string
+		Expected string
 	}{
-		"Zero should be false": {Value: 0, ExpectedResult: false},
-		"Equal to 1 should be true": {Value: 1, ExpectedResult: true},
-		"Equal to 3 should be true": {Value: 3, ExpectedResult: true},
-		"Equal to 7 should be true": {Value: 7, ExpectedResult: true},
-		"Negative number should be false": {Value: -1, ExpectedResult: false},
-		"Any other number should be false": {Value: 20, ExpectedResult: false},
+		"Default file":       {Env: map[string]string{}, Expected: "sheetsservice.FileTokenStore"},
+		"Encrypted file":     {Env: map[string]string{"TOKEN_ENCRYPTION_KEY": "MDEyMzQ1Njc4OWFiY2RlZg=="}, Expected: "*sheetsservice.EncryptedFileTokenStore"},
+		"Postgres needs URL": {Env: map[string]string{"TOKEN_STORE": "postgres"}, Expected: "Missing environment variable DATABASE_URL"},
+		"Unknown store":      {Env: map[string]string{"TOKEN_STORE": "redis"}, Expected: `Unknown token store "redis". Use file or postgres`},
 	}
 	for testcase, data := range testCases {
-		got := shouldSendEmail(data.Value)
-		if got != data.ExpectedResult {
-			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.ExpectedResult, got)
+		envy.Temp(func() {
+			for name, value := range data.Env {
+				envy.Set(name, value)
+			}
+			store, err := newTokenStore()
+			got := fmt.Sprintf("%T", store)
+			if err != nil {
+				got = err.Error()
+			}
+			if got != data.Expected {
+				t.Errorf("%s\n\tExpected: %s, Got: %s\n", testcase, data.Expected, got)
+			}
+		})
+	}
+}
+
+func TestPluralDays(t *testing.T) {
+	testCases := map[int]string{0: "0 days", 1: "1 day", 3: "3 days", -1: "1 day", -3: "3 days"}
+	for value, expected := range testCases {
+		if got := pluralDays(value); got != expected {
+			t.Errorf("pluralDays(%d)\n\tExpected: %q, Got: %q\n", value, expected, got)
+		}
+	}
+}
+
+func TestEmailTemplate(t *testing.T) {
+	tmpl, err := parseEmailTemplate("../../"+defaultTemplate, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		Offset   int
+		Stage    string
+		Expected string
+	}{
+		"Before expiry": {Offset: 3, Expected: "will expire\n                                                    in 3 days."},
+		"Day of expiry": {Offset: 0, Expected: "expires today."},
+		"After expiry":  {Offset: -3, Expected: "expired\n                                                    3 days ago."},
+		"Expired email": {Offset: -1, Stage: reminder.StageExpired, Expected: "lasts until 8 May 2024"},
+		"Grace ending":  {Offset: -5, Stage: reminder.StageGraceEnding, Expected: "ends on 8 May 2024."},
+		"Win back":      {Offset: -30, Stage: reminder.StageWinBack, Expected: "30 days since"},
+	}
+	for testcase, data := range testCases {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, emailData{
+			SheetEntry: sheetdata.SheetEntry{FirstName: "Ada", EndDate: time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)},
+			TimeLeft:   pluralDays(data.Offset),
+			DaysLeft:   data.Offset,
+			Expired:    data.Offset < 0,
+			Stage:      data.Stage,
+			GraceEnds:  "8 May 2024",
+			GraceDays:  7,
+		})
+		if err != nil {
+			t.Fatalf("%s\n\tUnexpected error: %+v\n", testcase, err)
+		}
+		if !strings.Contains(buf.String(), data.Expected) {
+			t.Errorf("%s\n\tExpected the email to contain %q\n", testcase, data.Expected)
+		}
+	}
+}
+
+// fakeMailer records the messages it is asked to send, or fails with err
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+	err  error
+}
+
+func (f *fakeMailer) Send(msg mailer.Message) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	f.sent = append(f.sent, msg)
+	return fmt.Sprintf("msg-%d", len(f.sent)), nil
+}
+
+// setupHandlerTest makes csv the subscribers of the hub from the environment, with a reminder offset days before the
+// end date, an empty ledger and a fake mailer. The returned function removes the file and restores the globals.
+func setupHandlerTest(t *testing.T, csv string, offset int) (*fakeMailer, func()) {
+	dir, err := ioutil.TempDir("", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(dir, "subscribers.csv")
+	if err := ioutil.WriteFile(csvPath, []byte(csv), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	oldHeader, oldSubscribers, oldPolicy, oldTemplates := cronHeader, subscribers, policy, emailTemplates
+	oldLedger, oldLetters, oldMail := sentLedger, deadLetters, mailClient
+	cronHeader = "secret"
+	subscribers = &source.CSV{Path: csvPath}
+	policy = reminder.NewPolicy(reminder.Reminder{Offset: offset, Subject: messageSubject, Template: defaultTemplate})
+	emailTemplates = map[string]*template.Template{
+		defaultTemplate: template.Must(parseEmailTemplate("../../"+defaultTemplate, false)),
+	}
+	sentLedger = ledger.NewMemoryStore()
+	deadLetters = &ledger.MemoryDeadLetters{}
+	fake := &fakeMailer{}
+	mailClient = fake
+	return fake, func() {
+		cronHeader, subscribers, policy, emailTemplates = oldHeader, oldSubscribers, oldPolicy, oldTemplates
+		sentLedger, deadLetters, mailClient = oldLedger, oldLetters, oldMail
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCronPingHandler(t *testing.T) {
+	due := time.Now().In(sheetdata.DefaultLocation()).AddDate(0, 0, 3).Format("02/01/06")
+	fake, cleanup := setupHandlerTest(t, "First Name,Last Name,Phone,Email,End Date\n"+
+		"Ada,Obi,0800,ada@example.com,"+due+"\n"+
+		"Bola,Ade,0801,bola@example.com,01/01/20\n", 3)
+	defer cleanup()
+
+	for run := 1; run <= 2; run++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+		rec := httptest.NewRecorder()
+		cronPingHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Run %d: expected status 200, Got: %d %s", run, rec.Code, rec.Body)
+		}
+		var report runReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatalf("Run %d: unexpected error: %+v", run, err)
 		}
+		// The second run finds the reminder in the ledger and sends nothing
+		if report.RowsRead != 2 || report.EmailsSent != 2-run || report.EmailsSkipped != run {
+			t.Errorf("Run %d: unexpected report %+v", run, &report)
+		}
+	}
+	if len(fake.sent) != 1 || fake.sent[0].ToEmail != "ada@example.com" || !strings.Contains(fake.sent[0].HTML, "3 days") {
+		t.Errorf("Expected one reminder to ada@example.com, Got: %+v", fake.sent)
+	}
+
+	// A client that has already gone away gets nothing sent on its behalf
+	sentLedger = ledger.NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+	rec := httptest.NewRecorder()
+	cronPingHandler(rec, req)
+	var report runReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if report.EmailsSent != 0 || report.EmailsCancelled != 1 || len(fake.sent) != 1 {
+		t.Errorf("Expected the send to be cancelled, Got: %+v", &report)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	cronPingHandler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without the cron header, Got: %d", rec.Code)
+	}
+}
+
+func TestCronPingHandlerRetriesDeadLetters(t *testing.T) {
+	due := time.Now().In(sheetdata.DefaultLocation()).AddDate(0, 0, 3).Format("02/01/06")
+	fake, cleanup := setupHandlerTest(t, "First Name,Email,End Date\nAda,ada@example.com,"+due+"\n", 3)
+	defer cleanup()
+	letters := deadLetters.(*ledger.MemoryDeadLetters)
+	retryPolicy = retry.Policy{Attempts: 2, Base: time.Millisecond}
+	defer func() { retryPolicy = retry.DefaultPolicy }()
+	fake.err = &mailer.ResponseError{Code: http.StatusServiceUnavailable}
+
+	run := func() *runReport {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+		rec := httptest.NewRecorder()
+		cronPingHandler(rec, req)
+		report := &runReport{}
+		if err := json.NewDecoder(rec.Body).Decode(report); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		return report
+	}
+	// The provider keeps failing, so the reminder ends up in the dead letter list
+	if report := run(); len(report.SendFailures) != 1 {
+		t.Errorf("Expected 1 send failure, Got: %+v", report)
+	}
+	list, _ := letters.List()
+	if len(list) != 1 || list[0].Email != "ada@example.com" || list[0].Attempts != 1 {
+		t.Fatalf("Expected a dead letter for ada@example.com, Got: %+v", list)
+	}
+	firstFailedAt := list[0].FirstFailedAt
+	// The next run retries it and counts another failed attempt
+	if report := run(); len(report.SendFailures) != 1 {
+		t.Errorf("Expected 1 send failure, Got: %+v", report)
+	}
+	if list, _ := letters.List(); len(list) != 1 || list[0].Attempts != 2 || !list[0].FirstFailedAt.Equal(firstFailedAt) {
+		t.Fatalf("Expected a dead letter with 2 attempts, Got: %+v", list)
+	}
+	// The next run retries it and clears it once sent
+	fake.err = nil
+	if report := run(); report.EmailsSent != 1 {
+		t.Errorf("Expected the reminder to be retried, Got: %+v", report)
+	}
+	if list, _ := letters.List(); len(list) != 0 {
+		t.Errorf("Expected no dead letters, Got: %+v", list)
+	}
+
+	// The provider refusing the message isn't worth retrying, so it is not saved
+	sentLedger = ledger.NewMemoryStore()
+	fake.err = &mailer.ResponseError{Code: http.StatusBadRequest}
+	if report := run(); len(report.SendFailures) != 1 || report.ProviderRejections != 1 {
+		t.Errorf("Expected 1 rejected send, Got: %+v", report)
+	}
+	if list, _ := letters.List(); len(list) != 0 {
+		t.Errorf("Expected no dead letters, Got: %+v", list)
+	}
+}
+
+func TestValidateHandler(t *testing.T) {
+	due := time.Now().In(sheetdata.DefaultLocation()).AddDate(0, 0, 3).Format("02/01/06")
+	fake, cleanup := setupHandlerTest(t, "First Name,Email,End Date\n"+
+		"Ada,ada@example.com,"+due+"\n"+
+		"Bola,ada@example.com,someday\n", 3)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/validate", nil)
+	req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+	rec := httptest.NewRecorder()
+	validateHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d %s", rec.Code, rec.Body)
+	}
+	var report lint.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if report.RowsRead != 2 || len(report.Issues) != 2 ||
+		report.Issues[0].Kind != lint.DuplicateEmail || report.Issues[1].Cell != "C3" {
+		t.Errorf("Expected a duplicate email and a bad date on row 3, Got: %+v", report)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("Expected nothing to be sent, Got: %+v", fake.sent)
+	}
+}
+
+func TestCronPingHandlerDryRunAsOf(t *testing.T) {
+	fake, cleanup := setupHandlerTest(t, "First Name,Email,End Date\nAda,ada@example.com,2024-05-08\n", 7)
+	defer cleanup()
+
+	testCases := map[string]struct {
+		Query              string
+		ExpectedStatus     int
+		ExpectedRecipients int
+	}{
+		"A week before the end date": {Query: "?dry_run=true&as_of=2024-05-01", ExpectedStatus: http.StatusOK, ExpectedRecipients: 1},
+		"The day after":              {Query: "?dry_run=true&as_of=2024-05-02", ExpectedStatus: http.StatusOK, ExpectedRecipients: 0},
+		"Bad date":                   {Query: "?dry_run=true&as_of=01/05/2024", ExpectedStatus: http.StatusBadRequest},
+		"Without dry run":            {Query: "?as_of=2024-05-01", ExpectedStatus: http.StatusBadRequest},
+	}
+	for testcase, data := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/"+data.Query, nil)
+		req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+		rec := httptest.NewRecorder()
+		cronPingHandler(rec, req)
+		if rec.Code != data.ExpectedStatus {
+			t.Errorf("%s\n\tExpected status: %d, Got: %d %s\n", testcase, data.ExpectedStatus, rec.Code, rec.Body)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var plan runPlan
+		if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+			t.Fatalf("%s\n\tUnexpected error: %+v\n", testcase, err)
+		}
+		if !plan.DryRun || len(plan.Recipients) != data.ExpectedRecipients {
+			t.Errorf("%s\n\tExpected a dry run with %d recipients, Got: %+v\n", testcase, data.ExpectedRecipients, plan)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("Expected no emails to be sent in a dry run, Got: %+v", fake.sent)
 	}
-}
\ No newline at end of file
+}
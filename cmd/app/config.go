@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/gobuffalo/envy"
+	"github.com/pkg/errors"
+)
+
+// configVars maps the settings of the config file to the environment variables they stand for
+var configVars = map[string]string{
+	"env":                        "ENV",
+	"port":                       "PORT",
+	"cron_header":                "CRON_HEADER",
+	"timezone":                   "HUB_TIMEZONE",
+	"hubs_file":                  "HUBS_FILE",
+	"sender.name":                "SENDER_NAME",
+	"sender.from_email":          "FROM_EMAIL",
+	"sender.reply_to":            "REPLY_TO",
+	"source.kind":                "SOURCE",
+	"source.spreadsheet_id":      "SPREADSHEET_ID",
+	"source.read_range":          "READ_RANGE",
+	"source.file":                "SOURCE_FILE",
+	"source.xlsx_sheet":          "XLSX_SHEET",
+	"source.value_render":        "SHEETS_VALUE_RENDER_OPTION",
+	"google.client_secret":       "CLIENT_SECRET",
+	"google.delegated_user":      "DELEGATED_USER",
+	"google.token_store":         "TOKEN_STORE",
+	"google.token_file":          "TOKEN_FILE",
+	"google.database_url":        "DATABASE_URL",
+	"google.token_encryption":    "TOKEN_ENCRYPTION_KEY",
+	"columns.first_name":         "FIRST_NAME_HEADERS",
+	"columns.last_name":          "LAST_NAME_HEADERS",
+	"columns.email":              "EMAIL_HEADERS",
+	"columns.end_date":           "END_DATE_HEADERS",
+	"columns.status":             "STATUS_HEADERS",
+	"columns.plan":               "PLAN_HEADERS",
+	"columns.date_layouts":       "DATE_LAYOUTS",
+	"schedule.reminder_offsets":  "REMINDER_OFFSETS",
+	"schedule.expiring_days":     "EXPIRING_DAYS",
+	"schedule.grace_days":        "GRACE_DAYS",
+	"schedule.churn_days":        "CHURN_DAYS",
+	"schedule.lifecycle_emails":  "LIFECYCLE_EMAILS",
+	"templates.dir":              "TEMPLATE_DIR",
+	"templates.email":            "EMAIL_TEMPLATE",
+	"templates.digest":           "DIGEST_TEMPLATE",
+	"digest.staff_emails":        "STAFF_EMAILS",
+	"digest.days":                "DIGEST_DAYS",
+	"mail.backend":               "MAILER",
+	"mail.sendgrid_api_key":      "SENDGRID_API_KEY",
+	"mail.smtp_addr":             "SMTP_ADDR",
+	"mail.smtp_username":         "SMTP_USERNAME",
+	"mail.smtp_password":         "SMTP_PASSWORD",
+	"mail.dir":                   "MAIL_DIR",
+	"sending.concurrency":        "SEND_CONCURRENCY",
+	"sending.rate":               "SEND_RATE",
+	"retry.attempts":             "RETRY_ATTEMPTS",
+	"retry.base_delay":           "RETRY_BASE_DELAY",
+	"retry.max_delay":            "RETRY_MAX_DELAY",
+	"retry.dead_letter_attempts": "DEAD_LETTER_ATTEMPTS",
+	"retry.dead_letter_max_age":  "DEAD_LETTER_MAX_AGE",
+	"files.ledger":               "LEDGER_FILE",
+	"files.dead_letters":         "DEAD_LETTER_FILE",
+	"lint.max_past_days":         "LINT_MAX_PAST_DAYS",
+	"lint.max_future_days":       "LINT_MAX_FUTURE_DAYS",
+}
+
+// Lists in the config file are joined with commas for their environment variable, except for these
+var listSeparators = map[string]string{"DATE_LAYOUTS": ";"}
+
+// loadConfigFile reads the TOML config file at path, if there is one. Its settings become the values of the
+// environment variables that are not set, after ${NAME} references in them are replaced with the environment variable
+// NAME. The hubs it lists are returned. Every problem with the settings is returned, so they can all be fixed at once,
+// and then none of the settings are used; a file that isn't valid TOML only gets the first syntax error.
+func loadConfigFile(path string) ([]hubConfig, []string) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []string{errors.WithMessage(err, "Unable to read config file").Error()}
+	}
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, []string{path + ": " + err.Error()}
+	}
+	problems := expandReferences(doc)
+	c := &configFile{vars: map[string]string{}}
+	c.read(doc)
+	if problems = append(problems, c.problems...); len(problems) > 0 {
+		return nil, prefixAll(path+": ", problems)
+	}
+	for envVar, value := range c.vars {
+		if _, err := envy.MustGet(envVar); err != nil {
+			envy.Set(envVar, value)
+		}
+	}
+	return c.hubs, nil
+}
+
+// reference is a ${NAME} reference to an environment variable in a string of the config file
+var reference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandReferences replaces the ${NAME} references in the strings of doc with the environment variable NAME, e.g. to
+// keep secrets out of the file. The references to variables that aren't set are returned as problems.
+func expandReferences(doc map[string]interface{}) []string {
+	var problems []string
+	var expand func(path string, value interface{}) interface{}
+	expand = func(path string, value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return reference.ReplaceAllStringFunc(v, func(ref string) string {
+				name := ref[2 : len(ref)-1]
+				value, err := envy.MustGet(name)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s is not set", path, name))
+				}
+				return value
+			})
+		case []interface{}:
+			for i := range v {
+				v[i] = expand(fmt.Sprintf("%s[%d]", path, i), v[i])
+			}
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				at := key
+				if path != "" {
+					at = path + "." + key
+				}
+				v[key] = expand(at, v[key])
+			}
+		case []map[string]interface{}:
+			for i := range v {
+				expand(fmt.Sprintf("%s[%d]", path, i), v[i])
+			}
+		}
+		return value
+	}
+	expand("", doc)
+	return problems
+}
+
+// configFile holds what has been read from a config file
+type configFile struct {
+	vars     map[string]string
+	hubs     []hubConfig
+	problems []string
+}
+
+func (c *configFile) read(doc map[string]interface{}) {
+	for _, key := range sortedKeys(doc) {
+		switch key {
+		case "reminders":
+			c.reminders("reminders", "REMINDER_", doc[key])
+		case "plans":
+			c.plans(doc[key])
+		case "hubs":
+			c.readHubs(doc[key])
+		default:
+			c.settings(key, doc[key])
+		}
+	}
+}
+
+// settings reads the settings of configVars at path and below it
+func (c *configFile) settings(path string, value interface{}) {
+	if table, ok := value.(map[string]interface{}); ok {
+		for _, key := range sortedKeys(table) {
+			c.settings(path+"."+key, table[key])
+		}
+		return
+	}
+	envVar, ok := configVars[path]
+	if !ok {
+		c.problem("%s is not a setting", path)
+		return
+	}
+	c.set(path, envVar, value)
+}
+
+// set sets envVar to the text of the value at path
+func (c *configFile) set(path, envVar string, value interface{}) {
+	sep, ok := listSeparators[envVar]
+	if !ok {
+		sep = ","
+	}
+	if text, ok := settingText(value, sep); ok {
+		c.vars[envVar] = text
+		return
+	}
+	c.problem("%s must be a string, number, boolean or list of them", path)
+}
+
+// reminders reads the subject and template of each reminder in a table keyed by offset,
+// e.g. [reminders.-3] for REMINDER_SUBJECT_NEG_3 and REMINDER_TEMPLATE_NEG_3
+func (c *configFile) reminders(path, prefix string, value interface{}) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		c.problem("%s must be a table", path)
+		return
+	}
+	for _, offset := range sortedKeys(table) {
+		n, err := strconv.Atoi(offset)
+		settings, ok := table[offset].(map[string]interface{})
+		if err != nil || !ok {
+			c.problem("%s.%s must be a table named after a reminder offset, e.g. [%s.7]", path, offset, path)
+			continue
+		}
+		key := reminder.OffsetKey(n)
+		for _, name := range sortedKeys(settings) {
+			at := path + "." + offset + "." + name
+			switch name {
+			case "subject":
+				c.set(at, prefix+"SUBJECT_"+key, settings[name])
+			case "template":
+				c.set(at, prefix+"TEMPLATE_"+key, settings[name])
+			default:
+				c.problem("%s is not a setting", at)
+			}
+		}
+	}
+}
+
+// plans reads a table of plans, e.g. [plans.weekly], into PLANS and the settings of each plan
+func (c *configFile) plans(value interface{}) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		c.problem("plans must be a table")
+		return
+	}
+	var names []string
+	for _, name := range sortedKeys(table) {
+		settings, ok := table[name].(map[string]interface{})
+		if !ok {
+			c.problem("plans.%s must be a table", name)
+			continue
+		}
+		names = append(names, name)
+		prefix := planEnvPrefix(sheetdata.NormalisePlan(name))
+		for _, key := range sortedKeys(settings) {
+			at := "plans." + name + "." + key
+			switch key {
+			case "offsets", "channels", "template":
+				c.set(at, prefix+strings.ToUpper(key), settings[key])
+			case "reminders":
+				c.reminders(at, prefix, settings[key])
+			default:
+				c.problem("%s is not a setting", at)
+			}
+		}
+	}
+	c.vars["PLANS"] = strings.Join(names, ",")
+}
+
+// readHubs reads the [[hubs]] tables, which have the fields of a hub in HUBS_FILE
+func (c *configFile) readHubs(value interface{}) {
+	tables, ok := value.([]map[string]interface{})
+	if !ok {
+		c.problem("hubs must be written as [[hubs]] tables")
+		return
+	}
+	for _, table := range tables {
+		for key, value := range table {
+			// Lists such as reminder_offsets are comma separated in a hub's fields
+			if list, ok := value.([]interface{}); ok {
+				if text, ok := settingText(list, ","); ok {
+					table[key] = text
+				}
+			}
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{"hubs": tables})
+	if err != nil {
+		c.problem("hubs: %v", err)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file hubsFile
+	if err := dec.Decode(&file); err != nil {
+		c.problem("hubs: %v", err)
+		return
+	}
+	c.hubs = file.Hubs
+	for _, problem := range checkHubs(file.Hubs) {
+		c.problem("hubs: %s", problem)
+	}
+}
+
+func (c *configFile) problem(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// settingText formats a value of the config file as an environment variable, joining lists with sep
+func settingText(value interface{}, sep string) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, ok := settingText(item, sep)
+			if _, isList := item.([]interface{}); !ok || isList {
+				return "", false
+			}
+			items[i] = text
+		}
+		return strings.Join(items, sep), true
+	}
+	return "", false
+}
+
+func sortedKeys(t map[string]interface{}) []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func prefixAll(prefix string, lines []string) []string {
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return lines
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gobuffalo/envy"
+)
+
+const testConfig = `
+env = "dev"
+port = 8080
+
+[sender]
+name = "SprintHub Yaba"
+from_email = "yaba@sprinthub.com.ng"
+
+[mail]
+sendgrid_api_key = "${TEST_SENDGRID_KEY}"
+
+[schedule]
+reminder_offsets = [14, 7, 1]
+
+[columns]
+email = ["Email Address", "Mail"]
+date_layouts = ["2/1/2006", "2006-01-02"]
+
+[reminders.-3]
+subject = "Come back"
+
+[plans.weekly]
+offsets = "2,0"
+
+[plans."annual plus".reminders.30]
+template = "annual.html"
+
+[[hubs]]
+name = "Lekki"
+spreadsheet_id = "sheet"
+read_range = "Sheet1!A1:F"
+reminder_offsets = [3, 1]
+[hubs.brand]
+address = ["1 Admiralty Way", "Lekki"]
+[hubs.mail]
+backend = "smtp"
+smtp_addr = "smtp.sprinthub.com.ng:587"
+`
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeTempFile(t, testConfig)
+	defer os.Remove(path)
+	envy.Temp(func() {
+		envy.Set("TEST_SENDGRID_KEY", "SG.secret")
+		envy.Set("PORT", "3000")
+		hubConfigs, problems := loadConfigFile(path)
+		if len(problems) > 0 {
+			t.Fatalf("Unexpected problems: %q", problems)
+		}
+		for envVar, expected := range map[string]string{
+			"ENV":                          "dev",
+			"PORT":                         "3000",
+			"SENDER_NAME":                  "SprintHub Yaba",
+			"FROM_EMAIL":                   "yaba@sprinthub.com.ng",
+			"SENDGRID_API_KEY":             "SG.secret",
+			"REMINDER_OFFSETS":             "14,7,1",
+			"EMAIL_HEADERS":                "Email Address,Mail",
+			"DATE_LAYOUTS":                 "2/1/2006;2006-01-02",
+			"REMINDER_SUBJECT_NEG_3":       "Come back",
+			"PLANS":                        "annual plus,weekly",
+			"PLAN_WEEKLY_OFFSETS":          "2,0",
+			"PLAN_ANNUAL_PLUS_TEMPLATE_30": "annual.html",
+		} {
+			if got := envy.Get(envVar, ""); got != expected {
+				t.Errorf("%s\n\tExpected: %s, Got: %s\n", envVar, expected, got)
+			}
+		}
+		expectedHubs := []hubConfig{{
+			Name: "Lekki", SpreadsheetID: "sheet", ReadRange: "Sheet1!A1:F", ReminderOffsets: "3,1",
+			Brand: brand{Address: []string{"1 Admiralty Way", "Lekki"}},
+			Mail:  mailConfig{Backend: "smtp", SMTPAddr: "smtp.sprinthub.com.ng:587"},
+		}}
+		if !reflect.DeepEqual(hubConfigs, expectedHubs) {
+			t.Errorf("Hubs\n\tExpected: %+v, Got: %+v\n", expectedHubs, hubConfigs)
+		}
+	})
+}
+
+func TestLoadConfigFileProblems(t *testing.T) {
+	testCases := map[string]struct {
+		Config   string
+		Expected []string
+	}{
+		"Bad TOML": {
+			Config:   "port = 80 80\n",
+			Expected: []string{"Near line 1 (last key parsed ''): expected a top-level item to end with a newline, comment, or EOF, but got '8' instead"},
+		},
+		"Unset references": {
+			Config: "[mail]\nsendgrid_api_key = \"${TEST_MISSING_KEY}\"\nsmtp_password = \"${TEST_MISSING_PASSWORD}\"\n" +
+				"[[hubs]]\nreply_to = \"${TEST_MISSING_HUB}@sprinthub.com.ng\"\n",
+			Expected: []string{
+				"hubs[0].reply_to: TEST_MISSING_HUB is not set",
+				"mail.sendgrid_api_key: TEST_MISSING_KEY is not set",
+				"mail.smtp_password: TEST_MISSING_PASSWORD is not set",
+			},
+		},
+		"Bad settings": {
+			Config: "prot = 80\n[sender]\nemail = \"a@b.com\"\n[reminders.soon]\nsubject = \"Soon\"\n[plans.weekly]\ncolour = \"red\"\n" +
+				"[[hubs]]\nname = \"Lekki\"\nsource = \"ftp\"\n",
+			Expected: []string{
+				"hubs: Lekki: unknown source \"ftp\", use sheets, csv or xlsx",
+				"plans.weekly.colour is not a setting",
+				"prot is not a setting",
+				"reminders.soon must be a table named after a reminder offset, e.g. [reminders.7]",
+				"sender.email is not a setting",
+			},
+		},
+		"Unset references and bad settings": {
+			Config: "prot = 80\n[sender]\nname = \"SprintHub Yaba\"\nreply_to = \"${TEST_MISSING_REPLY_TO}\"\n",
+			Expected: []string{
+				"sender.reply_to: TEST_MISSING_REPLY_TO is not set",
+				"prot is not a setting",
+			},
+		},
+	}
+	for testcase, data := range testCases {
+		path := writeTempFile(t, data.Config)
+		envy.Temp(func() {
+			hubConfigs, problems := loadConfigFile(path)
+			expected := prefixAll(path+": ", data.Expected)
+			if !reflect.DeepEqual(problems, expected) {
+				t.Errorf("%s\n\tExpected: %q, Got: %q\n", testcase, expected, problems)
+			}
+			if name := envy.Get("SENDER_NAME", ""); hubConfigs != nil || name != "" {
+				t.Errorf("%s\n\tExpected no settings to be used, Got: %+v %q\n", testcase, hubConfigs, name)
+			}
+		})
+		os.Remove(path)
+	}
+}
+
+func TestSetupEnvVars(t *testing.T) {
+	envy.Temp(func() {
+		envy.Set("PORT", "3000")
+		var port, cronHeader, apiKey string
+		err := setupEnvVars(map[string]*string{"PORT": &port, "CRON_HEADER": &cronHeader, "SENDGRID_API_KEY": &apiKey})
+		expected := "Missing environment variables CRON_HEADER, SENDGRID_API_KEY"
+		if err == nil || err.Error() != expected || port != "3000" {
+			t.Errorf("Expected: %s, Got: %v %s\n", expected, err, port)
+		}
+	})
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/pkg/errors"
+)
+
+const (
+	digestSubject = "Subscriptions expiring soon: %s"
+	// Template for the staff digest email
+	defaultDigestTemplate = "digest-template.html"
+	// Days ahead the staff digest lists expiring subscriptions for
+	defaultDigestDays = 7
+	// The digest is recorded in the ledger as this kind of record, with the day it covers as the end date
+	digestLedgerKind = "staff_digest"
+)
+
+var (
+	// Addresses the staff digest is sent to. No digest is sent if there are none.
+	staffEmails []string
+	digestDays  = defaultDigestDays
+	// Template of the staff digest email
+	digestTemplate *template.Template
+)
+
+// staffDigest is the daily summary for the front desk: who is about to expire, who expired yesterday
+// and which rows of the sheet need fixing
+type staffDigest struct {
+	Date             string       `json:"date"`
+	Days             int          `json:"days"`
+	Expiring         []digestRow  `json:"expiring"`
+	ExpiredYesterday []digestRow  `json:"expired_yesterday"`
+	ParseFailures    []rowFailure `json:"parse_failures"`
+	// EmailSuggestions are the addresses that look like typos, which are still sent to
+	EmailSuggestions []emailSuggestion `json:"email_suggestions"`
+	// Hub and Brand are the hub the digest is for, which is unnamed in a single hub deployment
+	Hub   string `json:"-"`
+	Brand brand  `json:"-"`
+}
+
+// digestRow is a subscriber listed in the staff digest
+type digestRow struct {
+	Row      int    `json:"row"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	EndDate  string `json:"end_date"`
+	DaysLeft int    `json:"days_left"`
+}
+
+// emailSuggestion is an address in the sheet that looks like a typo, with the likely correction
+type emailSuggestion struct {
+	Row        int    `json:"row"`
+	Email      string `json:"email"`
+	Suggestion string `json:"suggestion"`
+}
+
+// newStaffDigest summarises the subscribers of a plan. Expiring lists those with up to days left, soonest first.
+func newStaffDigest(plan *runPlan, days int) *staffDigest {
+	d := &staffDigest{
+		Date:             plan.clock.Now().In(hubLocation).Format("Monday 2 January 2006"),
+		Days:             days,
+		Expiring:         []digestRow{},
+		ExpiredYesterday: []digestRow{},
+		ParseFailures:    plan.ParseFailures,
+		EmailSuggestions: []emailSuggestion{},
+	}
+	for _, row := range plan.subscribers {
+		for _, email := range row.entry.Emails {
+			if suggestion := sheetdata.SuggestEmail(email); suggestion != "" {
+				d.EmailSuggestions = append(d.EmailSuggestions, emailSuggestion{Row: row.num, Email: email, Suggestion: suggestion})
+			}
+		}
+		daysLeft := row.entry.DaysLeft()
+		r := digestRow{
+			Row:      row.num,
+			Name:     row.entry.FullName(),
+			Email:    strings.Join(row.entry.Emails, ", "),
+			EndDate:  row.entry.EndDate.Format("2 Jan 2006"),
+			DaysLeft: daysLeft,
+		}
+		switch {
+		case daysLeft == -1:
+			d.ExpiredYesterday = append(d.ExpiredYesterday, r)
+		case daysLeft >= 0 && daysLeft <= days:
+			d.Expiring = append(d.Expiring, r)
+		}
+	}
+	sort.SliceStable(d.Expiring, func(i, j int) bool {
+		return d.Expiring[i].DaysLeft < d.Expiring[j].DaysLeft
+	})
+	return d
+}
+
+// sendStaffDigest sends the digest of a plan to the staff, once a day. It reports whether a digest was sent.
+func (h *hub) sendStaffDigest(ctx context.Context, plan *runPlan) (bool, error) {
+	if len(h.staffEmails) == 0 {
+		return false, nil
+	}
+	key := ledger.Key{Kind: digestLedgerKind, EndDate: plan.clock.Now().In(hubLocation)}
+	if sent, err := h.sentLedger.Has(key); err != nil || sent {
+		return false, err
+	}
+	d := newStaffDigest(plan, digestDays)
+	d.Hub, d.Brand = h.name, h.brand
+	var html bytes.Buffer
+	if err := digestTemplate.Execute(&html, d); err != nil {
+		return false, errors.WithMessage(err, "Cannot execute digest template.")
+	}
+	subject := fmt.Sprintf(digestSubject, d.Date)
+	if h.name != "" {
+		subject = h.name + ": " + subject
+	}
+	msg := mailer.Message{
+		FromName:  h.sender.Name,
+		FromEmail: h.sender.Email,
+		ToName:    h.sender.Name + " staff",
+		ToEmail:   h.staffEmails[0],
+		Cc:        h.staffEmails[1:],
+		Subject:   subject,
+		Text:      d.text(),
+		HTML:      html.String(),
+	}
+	var messageID string
+	err := retryPolicy.Do(ctx, func() (err error) {
+		messageID, err = h.mail.Send(msg)
+		return err
+	})
+	if err != nil {
+		return false, errors.WithMessage(err, "Failed to send the staff digest")
+	}
+	if err := h.sentLedger.Record(ledger.Entry{Key: key, SentAt: plan.clock.Now().UTC(), MessageID: messageID}); err != nil {
+		return true, errors.WithMessage(err, "Failed to record the staff digest")
+	}
+	return true, nil
+}
+
+// text is the plain text version of the digest
+func (d *staffDigest) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Subscriptions on %s\n", d.Date)
+	section := func(title string, rows []digestRow) {
+		fmt.Fprintf(&b, "\n%s: %d\n", title, len(rows))
+		for _, r := range rows {
+			fmt.Fprintf(&b, "- Row %d: %s <%s>, ends %s (%s)\n", r.Row, r.Name, r.Email, r.EndDate, reminderName(r.DaysLeft))
+		}
+	}
+	section(fmt.Sprintf("Expiring in the next %s", pluralDays(d.Days)), d.Expiring)
+	section("Expired yesterday", d.ExpiredYesterday)
+	fmt.Fprintf(&b, "\nRows that could not be read: %d\n", len(d.ParseFailures))
+	for _, f := range d.ParseFailures {
+		fmt.Fprintf(&b, "- Row %d: %s\n", f.Row, f.Reason)
+	}
+	if len(d.EmailSuggestions) > 0 {
+		fmt.Fprintf(&b, "\nEmails that may be typos: %d\n", len(d.EmailSuggestions))
+		for _, s := range d.EmailSuggestions {
+			fmt.Fprintf(&b, "- Row %d: %s, did you mean %s?\n", s.Row, s.Email, s.Suggestion)
+		}
+	}
+	return b.String()
+}
+
+// loadStaffDigest reads STAFF_EMAILS, DIGEST_DAYS and DIGEST_TEMPLATE. The digest is off if STAFF_EMAILS is empty,
+// unless hubsHaveStaff says that some hub has staff emails of its own.
+func loadStaffDigest(emails, days, templateFile string, hubsHaveStaff bool) error {
+	var err error
+	if strings.TrimSpace(emails) != "" {
+		if staffEmails, err = sheetdata.ParseEmails(emails); err != nil {
+			return errors.WithMessage(err, "Bad STAFF_EMAILS value")
+		}
+	} else if !hubsHaveStaff {
+		return nil
+	}
+	if digestDays, err = strconv.Atoi(days); err != nil || digestDays < 0 {
+		return errors.Errorf("Bad DIGEST_DAYS %q. It must be a whole number of days", days)
+	}
+	digestTemplate, err = template.New(filepath.Base(templateFile)).
+		Funcs(templateFuncs).
+		ParseFiles(templateFile)
+	return errors.WithMessage(err, "Cannot parse the digest template")
+}
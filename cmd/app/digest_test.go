@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
+)
+
+func digestPlan(t *testing.T) *runPlan {
+	policy = reminder.NewPolicy(reminder.Reminder{Offset: 7, Subject: "A week left", Template: defaultTemplate})
+	deadLetters = &ledger.MemoryDeadLetters{}
+	clock := sheetdata.FixedClock(time.Date(2024, time.April, 24, 12, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Last Name", "Email", "End Date"},
+		{"Ada", "Obi", "ada@example.com", "01/05/24"},
+		{"Bola", "Ade", "bola@example.com; accounts@example.com", "25/04/24"},
+		{"Chidi", "Eze", "chidi@example.com", "23/04/24"},
+		{"Dayo", "Ola", "dayo@gmial.com", "02/05/24"},
+		{"Emeka", "Nwosu", "emeka@example", "01/05/24"},
+	}
+	plan, err := envHub().planReminders(values, source.RangeStart{Row: 1}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	return plan
+}
+
+func TestNewStaffDigest(t *testing.T) {
+	sentLedger = ledger.NewMemoryStore()
+	d := newStaffDigest(digestPlan(t), 7)
+
+	if d.Date != "Wednesday 24 April 2024" {
+		t.Errorf("Expected the digest of Wednesday 24 April 2024, Got: %s", d.Date)
+	}
+	// Soonest first, and Dayo with 8 days left is not listed yet
+	if len(d.Expiring) != 2 || d.Expiring[0].Row != 3 || d.Expiring[1].Row != 2 {
+		t.Errorf("Expected rows 3 and 2 to be expiring, Got: %+v", d.Expiring)
+	}
+	if got := d.Expiring[0]; got.Name != "Bola Ade" || got.Email != "bola@example.com, accounts@example.com" || got.DaysLeft != 1 {
+		t.Errorf("Unexpected expiring row %+v", got)
+	}
+	if len(d.ExpiredYesterday) != 1 || d.ExpiredYesterday[0].Email != "chidi@example.com" {
+		t.Errorf("Expected chidi@example.com to have expired yesterday, Got: %+v", d.ExpiredYesterday)
+	}
+	if len(d.ParseFailures) != 1 || d.ParseFailures[0].Row != 6 {
+		t.Errorf("Expected a parse failure on row 6, Got: %+v", d.ParseFailures)
+	}
+	// Dayo's address may be a typo, but it is still read
+	if len(d.EmailSuggestions) != 1 || d.EmailSuggestions[0].Row != 5 || d.EmailSuggestions[0].Suggestion != "dayo@gmail.com" {
+		t.Errorf("Expected a suggestion of dayo@gmail.com for row 5, Got: %+v", d.EmailSuggestions)
+	}
+	text := d.text()
+	for _, want := range []string{"Expiring in the next 7 days: 2", "Row 3: Bola Ade", "Expired yesterday: 1", "Row 6:", "did you mean dayo@gmail.com?"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected the text to contain %q, Got:\n%s", want, text)
+		}
+	}
+}
+
+func TestSendStaffDigest(t *testing.T) {
+	sentLedger = ledger.NewMemoryStore()
+	fake := &fakeMailer{}
+	mailClient = fake
+	if err := loadStaffDigest("", "7", "../../"+defaultDigestTemplate, false); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if sent, err := envHub().sendStaffDigest(context.Background(), digestPlan(t)); sent || err != nil {
+		t.Errorf("Expected no digest without STAFF_EMAILS, Got: %v %+v", sent, err)
+	}
+
+	if err := loadStaffDigest("desk@example.com, Manager@example.com", "7", "../../"+defaultDigestTemplate, false); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	defer func() { staffEmails = nil }()
+	for run := 1; run <= 2; run++ {
+		sent, err := envHub().sendStaffDigest(context.Background(), digestPlan(t))
+		if err != nil {
+			t.Fatalf("Run %d: unexpected error: %+v", run, err)
+		}
+		// The digest goes out once a day, however often the cron fires
+		if sent != (run == 1) {
+			t.Errorf("Run %d: expected sent to be %v, Got: %v", run, run == 1, sent)
+		}
+	}
+	if len(fake.sent) != 1 {
+		t.Fatalf("Expected 1 digest, Got: %+v", fake.sent)
+	}
+	msg := fake.sent[0]
+	if msg.ToEmail != "desk@example.com" || len(msg.Cc) != 1 || msg.Cc[0] != "manager@example.com" {
+		t.Errorf("Expected the digest to desk@example.com copied to manager@example.com, Got: %s %v", msg.ToEmail, msg.Cc)
+	}
+	if !strings.Contains(msg.HTML, "bola@example.com") || !strings.Contains(msg.HTML, "1 day left") || !strings.Contains(msg.HTML, "dayo@gmail.com") {
+		t.Errorf("Expected the HTML to list bola@example.com, Got:\n%s", msg.HTML)
+	}
+
+	testCases := map[string]struct {
+		emails, days, template string
+		hubsHaveStaff          bool
+	}{
+		"bad email":                  {emails: "desk@sprinthub", days: "7"},
+		"bad days":                   {emails: "desk@example.com", days: "a week"},
+		"bad days for a hub":         {days: "a week", hubsHaveStaff: true},
+		"missing template for a hub": {days: "7", template: "missing.html", hubsHaveStaff: true},
+	}
+	for name, tc := range testCases {
+		tmpl := "../../" + defaultDigestTemplate
+		if tc.template != "" {
+			tmpl = tc.template
+		}
+		if err := loadStaffDigest(tc.emails, tc.days, tmpl, tc.hubsHaveStaff); err == nil {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", name, "an error", err)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/lint"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
+	"github.com/pkg/errors"
+)
+
+// hub is a location with its own subscribers, reminder schedule, sender, ledger and branding.
+// A deployment without a hubs file has a single hub configured by the environment, see envHub.
+type hub struct {
+	// name is empty for the hub configured by the environment
+	name         string
+	subscribers  source.SubscriberSource
+	policy       reminder.Policy
+	planPolicies map[string]reminder.Policy
+	sentLedger   ledger.Store
+	deadLetters  ledger.DeadLetters
+	sender       sender
+	brand        brand
+	// mail sends the hub's emails. It is nil when the app isn't sending, e.g. for a dry run.
+	mail mailer.Mailer
+	// Addresses the staff digest of the hub is sent to
+	staffEmails []string
+}
+
+// sender is who the emails of a hub are from
+type sender struct {
+	Name, Email string
+	// ReplyTo is the address replies go to, if not the sender's
+	ReplyTo string
+}
+
+// brand is how a hub presents itself in its emails. Templates get it as .Brand.
+type brand struct {
+	Name     string   `json:"name"`
+	LogoURL  string   `json:"logo_url"`
+	Color    string   `json:"color"`
+	RenewURL string   `json:"renew_url"`
+	Website  string   `json:"website"`
+	Address  []string `json:"address"`
+	Phone    string   `json:"phone"`
+}
+
+// defaultBrand is SprintHub's main hub
+var defaultBrand = brand{
+	Name:     "SprintHub",
+	LogoURL:  "https://storage.googleapis.com/default-sprinthub/images/SprintHub-Logo.png",
+	Color:    "#008000",
+	RenewURL: "https://paystack.com/pay/sprinthub",
+	Website:  "https://sprinthub.com.ng",
+	Address:  []string{"2nd Floor, Pavilion Building", "Off East West Road, Alakahia, Rivers State, Nigeria"},
+	Phone:    "+234 (0) (812) (873) (9485)",
+}
+
+// hexColor matches the colors a brand may use, e.g. #008000
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// withDefaults fills the settings a brand leaves out from the default brand
+func (b brand) withDefaults() brand {
+	if b.Name == "" {
+		b.Name = defaultBrand.Name
+	}
+	if b.LogoURL == "" {
+		b.LogoURL = defaultBrand.LogoURL
+	}
+	if b.Color == "" {
+		b.Color = defaultBrand.Color
+	}
+	if b.RenewURL == "" {
+		b.RenewURL = defaultBrand.RenewURL
+	}
+	if b.Website == "" {
+		b.Website = defaultBrand.Website
+	}
+	if b.Address == nil {
+		b.Address = defaultBrand.Address
+	}
+	if b.Phone == "" {
+		b.Phone = defaultBrand.Phone
+	}
+	return b
+}
+
+// WebsiteName is the website without its scheme, e.g. sprinthub.com.ng
+func (b brand) WebsiteName() string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(b.Website, "https://"), "http://"), "/")
+}
+
+// CSSColor is the brand color for use in style attributes. It is checked when the hubs are loaded.
+func (b brand) CSSColor() template.CSS {
+	if !hexColor.MatchString(b.Color) {
+		return template.CSS(defaultBrand.Color)
+	}
+	return template.CSS(b.Color)
+}
+
+// Hubs of a multi-location deployment, read from HUBS_FILE or the config file. There are none in a single hub deployment.
+var hubs []*hub
+
+// envHub returns the hub configured by the environment variables
+func envHub() *hub {
+	return &hub{
+		subscribers:  subscribers,
+		policy:       policy,
+		planPolicies: planPolicies,
+		sentLedger:   sentLedger,
+		deadLetters:  deadLetters,
+		sender:       mainSender,
+		brand:        defaultBrand,
+		mail:         mailClient,
+		staffEmails:  staffEmails,
+	}
+}
+
+// allHubs returns the hubs a cron run processes
+func allHubs() []*hub {
+	if len(hubs) > 0 {
+		return hubs
+	}
+	return []*hub{envHub()}
+}
+
+// hubsFile is the layout of HUBS_FILE
+type hubsFile struct {
+	Hubs []hubConfig `json:"hubs"`
+}
+
+// hubConfig configures one hub. The source settings are required; the others default to those of
+// a single hub deployment.
+type hubConfig struct {
+	Name string `json:"name"`
+	// Source is "sheets" (the default), "csv" or "xlsx", read from SpreadsheetID and ReadRange or from SourceFile
+	Source        string `json:"source"`
+	SpreadsheetID string `json:"spreadsheet_id"`
+	ReadRange     string `json:"read_range"`
+	SourceFile    string `json:"source_file"`
+	XLSXSheet     string `json:"xlsx_sheet"`
+	// Sender of the hub's emails
+	SenderName string `json:"sender_name"`
+	FromEmail  string `json:"from_email"`
+	ReplyTo    string `json:"reply_to"`
+	// ReminderOffsets and Template replace REMINDER_OFFSETS and the default email template
+	ReminderOffsets string `json:"reminder_offsets"`
+	Template        string `json:"template"`
+	// Files of the hub's ledger and dead letters, by default named after the hub
+	LedgerFile     string `json:"ledger_file"`
+	DeadLetterFile string `json:"dead_letter_file"`
+	// StaffEmails replaces STAFF_EMAILS
+	StaffEmails string `json:"staff_emails"`
+	Brand       brand  `json:"brand"`
+	// Mail replaces the mail settings it sets, e.g. to send through the hub's own SendGrid account
+	Mail mailConfig `json:"mail"`
+}
+
+// hubSlug turns a hub name into a file name part, e.g. "port-harcourt" for "Port Harcourt"
+func hubSlug(name string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name)), "-")
+}
+
+// readHubsFile reads and checks the hub configurations in path. Every problem found is listed in the error.
+func readHubsFile(path string) ([]hubConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to read hubs file")
+	}
+	var file hubsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "Bad hubs file "+path)
+	}
+	if problems := checkHubs(file.Hubs); len(problems) > 0 {
+		return nil, errors.Errorf("Bad hubs file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return file.Hubs, nil
+}
+
+// checkHubs returns the problems with the hub configurations, naming the hub of each
+func checkHubs(configs []hubConfig) []string {
+	var problems []string
+	if len(configs) == 0 {
+		problems = append(problems, "no hubs")
+	}
+	slugs := map[string]string{}
+	for i, cfg := range configs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("hub %d", i+1)
+			problems = append(problems, name+": name is empty")
+		} else if other, ok := slugs[hubSlug(name)]; ok {
+			problems = append(problems, fmt.Sprintf("%s: name is too close to %s, their files would clash", name, other))
+		}
+		slugs[hubSlug(name)] = name
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+		}
+		switch cfg.Source {
+		case "", "sheets":
+			if cfg.SpreadsheetID == "" || cfg.ReadRange == "" {
+				problem("sheets source needs spreadsheet_id and read_range")
+			}
+		case "csv", "xlsx":
+			if cfg.SourceFile == "" {
+				problem("%s source needs source_file", cfg.Source)
+			}
+		default:
+			problem("unknown source %q, use sheets, csv or xlsx", cfg.Source)
+		}
+		for _, field := range []struct{ name, value string }{{"from_email", cfg.FromEmail}, {"reply_to", cfg.ReplyTo}} {
+			if _, err := sheetdata.NormaliseEmail(field.value); field.value != "" && err != nil {
+				problem("%s: %v", field.name, err)
+			}
+		}
+		if cfg.StaffEmails != "" {
+			if _, err := sheetdata.ParseEmails(cfg.StaffEmails); err != nil {
+				problem("staff_emails: %v", err)
+			}
+		}
+		if cfg.ReminderOffsets != "" {
+			if _, err := reminder.ParseOffsets(cfg.ReminderOffsets); err != nil {
+				problem("reminder_offsets: %v", err)
+			}
+		}
+		switch cfg.Mail.Backend {
+		case "", "sendgrid", "smtp", "file":
+		default:
+			problem("unknown mail backend %q, use sendgrid, smtp or file", cfg.Mail.Backend)
+		}
+		if cfg.Brand.Color != "" && !hexColor.MatchString(cfg.Brand.Color) {
+			problem("brand color %q is not a hex color such as #008000", cfg.Brand.Color)
+		}
+	}
+	return problems
+}
+
+// newHub sets up a hub from its configuration. interactive is passed on to the sheets source. The hub gets its own
+// mailer when sending, from its mail settings and the ones of the environment.
+func newHub(cfg hubConfig, interactive, sending bool) (*hub, error) {
+	h := &hub{
+		name:        cfg.Name,
+		sender:      sender{Name: cfg.SenderName, Email: cfg.FromEmail, ReplyTo: cfg.ReplyTo},
+		brand:       cfg.Brand.withDefaults(),
+		staffEmails: staffEmails,
+	}
+	if h.sender.Name == "" {
+		h.sender.Name = mainSender.Name
+	}
+	if h.sender.Email == "" {
+		h.sender.Email = mainSender.Email
+	}
+	if h.sender.ReplyTo == "" {
+		h.sender.ReplyTo = mainSender.ReplyTo
+	}
+	kind := cfg.Source
+	if kind == "" {
+		kind = "sheets"
+	}
+	var err error
+	src := sourceConfig{Kind: kind, SpreadsheetID: cfg.SpreadsheetID, ReadRange: cfg.ReadRange, File: cfg.SourceFile, XLSXSheet: cfg.XLSXSheet}
+	if h.subscribers, err = src.open(interactive); err != nil {
+		return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+	}
+	offsets := cfg.ReminderOffsets
+	if offsets == "" {
+		offsets = envOffsets()
+	}
+	tmpl := cfg.Template
+	if tmpl == "" {
+		tmpl = reminderTemplate
+	}
+	if h.policy, err = newReminderPolicy("", offsets, tmpl); err != nil {
+		return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+	}
+	if h.planPolicies, err = loadPlanPolicies(tmpl); err != nil {
+		return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+	}
+	if cfg.StaffEmails != "" {
+		if h.staffEmails, err = sheetdata.ParseEmails(cfg.StaffEmails); err != nil {
+			return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+		}
+	}
+	ledgerFile := cfg.LedgerFile
+	if ledgerFile == "" {
+		ledgerFile = "reminders-" + hubSlug(cfg.Name) + ".ledger"
+	}
+	if h.sentLedger, err = ledger.OpenFileStore(ledgerFile); err != nil {
+		return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+	}
+	deadLetterFile := cfg.DeadLetterFile
+	if deadLetterFile == "" {
+		deadLetterFile = "failed-reminders-" + hubSlug(cfg.Name) + ".json"
+	}
+	h.deadLetters = &ledger.FileDeadLetters{Path: deadLetterFile}
+	if sending {
+		if h.mail, err = newMailer(cfg.Mail.withDefaults(envMailConfig())); err != nil {
+			h.sentLedger.Close()
+			return nil, errors.WithMessage(err, "Hub "+cfg.Name)
+		}
+	}
+	return h, nil
+}
+
+// loadHubs sets up the hubs of a hubs file or the config file. If any hub can't be set up, none are returned and
+// the problems of every hub that failed are.
+func loadHubs(configs []hubConfig, interactive, sending bool) ([]*hub, []string) {
+	loaded := make([]*hub, 0, len(configs))
+	var problems []string
+	for _, cfg := range configs {
+		h, err := newHub(cfg, interactive, sending)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		loaded = append(loaded, h)
+	}
+	if len(problems) > 0 {
+		for _, h := range loaded {
+			h.sentLedger.Close()
+		}
+		return nil, problems
+	}
+	return loaded, nil
+}
+
+// policies returns every reminder schedule of the hub
+func (h *hub) policies() []reminder.Policy {
+	policies := []reminder.Policy{h.policy}
+	for _, p := range h.planPolicies {
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// hubReport is the run report of one hub of a multi-hub deployment, or why its run failed
+type hubReport struct {
+	Hub   string `json:"hub"`
+	Error string `json:"error,omitempty"`
+	*runReport
+}
+
+// hubPlan is the dry-run plan of one hub of a multi-hub deployment
+type hubPlan struct {
+	Hub   string `json:"hub"`
+	Error string `json:"error,omitempty"`
+	*runPlan
+}
+
+// hubLint is the sheet validation report of one hub of a multi-hub deployment
+type hubLint struct {
+	Hub   string `json:"hub"`
+	Error string `json:"error,omitempty"`
+	*lint.Report
+}
+
+// isolate runs fn for a hub, turning a panic into an error so that the other hubs still run. It only recovers
+// panics on the calling goroutine; the send jobs of a run recover their own.
+func isolate(h *hub, fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Hub %s panicked: %v\n%s", h.name, p, debug.Stack())
+			err = errors.Errorf("Hub %s failed: %v", h.name, p)
+		}
+	}()
+	return fn()
+}
+
+// hubsFailed reports whether the run of any hub failed
+func hubsFailed(reports []hubReport) bool {
+	for _, r := range reports {
+		if r.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// runHubs runs every hub in turn. A hub that fails doesn't stop the others.
+func runHubs(ctx context.Context) []hubReport {
+	reports := make([]hubReport, 0, len(hubs))
+	for _, h := range hubs {
+		result := hubReport{Hub: h.name}
+		err := isolate(h, func() (err error) {
+			result.runReport, err = h.run(ctx, sheetdata.SystemClock)
+			return err
+		})
+		if err != nil {
+			log.Printf("Hub %s: %+v\n", h.name, err)
+			result.Error = err.Error()
+		}
+		reports = append(reports, result)
+	}
+	return reports
+}
+
+// dryRunHubs plans the reminders of every hub on the clock's day, like dryRunPlan
+func dryRunHubs(ctx context.Context, clock sheetdata.Clock) []hubPlan {
+	plans := make([]hubPlan, 0, len(hubs))
+	for _, h := range hubs {
+		result := hubPlan{Hub: h.name}
+		err := isolate(h, func() (err error) {
+			result.runPlan, err = h.dryRunPlan(ctx, clock)
+			return err
+		})
+		if err != nil {
+			result.Error = err.Error()
+		}
+		plans = append(plans, result)
+	}
+	return plans
+}
+
+// lintHubs validates the sheet of every hub
+func lintHubs(ctx context.Context) []hubLint {
+	reports := make([]hubLint, 0, len(hubs))
+	for _, h := range hubs {
+		result := hubLint{Hub: h.name}
+		err := isolate(h, func() (err error) {
+			result.Report, err = h.lintSheet(ctx)
+			return err
+		})
+		if err != nil {
+			result.Error = err.Error()
+		}
+		reports = append(reports, result)
+	}
+	return reports
+}
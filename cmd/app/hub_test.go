@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/gobuffalo/envy"
+)
+
+func TestCheckHubs(t *testing.T) {
+	configs := []hubConfig{
+		{Name: "Alakahia", SpreadsheetID: "sheet", ReadRange: "Sheet1!A1:F"},
+		{Name: "Lekki", Source: "csv", ReplyTo: "lekki@sprinthub", Brand: brand{Color: "green"}},
+		{Name: "lekki!", Source: "ftp", ReminderOffsets: "7,soon", Mail: mailConfig{Backend: "pigeon"}},
+		{SpreadsheetID: "sheet"},
+	}
+	problems := checkHubs(configs)
+	expected := []string{
+		"Lekki: csv source needs source_file",
+		"Lekki: reply_to:",
+		"Lekki: brand color",
+		"lekki!: name is too close to Lekki",
+		"lekki!: unknown source",
+		"lekki!: reminder_offsets:",
+		"lekki!: unknown mail backend \"pigeon\"",
+		"hub 4: name is empty",
+		"hub 4: sheets source needs spreadsheet_id and read_range",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, Got: %q", len(expected), problems)
+	}
+	for i, e := range expected {
+		if !strings.HasPrefix(problems[i], e) {
+			t.Errorf("Problem %d\n\tExpected: %s..., Got: %s\n", i, e, problems[i])
+		}
+	}
+}
+
+func TestRunHubs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	due := time.Now().In(sheetdata.DefaultLocation()).AddDate(0, 0, 3).Format("02/01/06")
+	csvPath := filepath.Join(dir, "lekki.csv")
+	if err := ioutil.WriteFile(csvPath, []byte("First Name,Email,End Date\nAda,ada@example.com,"+due+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emailTemplates[defaultTemplate] = template.Must(parseEmailTemplate("../../"+defaultTemplate, false))
+	fake := &fakeMailer{}
+	mailClient = fake
+	// Only Lekki has staff emails, so the digest is loaded for it without STAFF_EMAILS
+	defer func(t *template.Template) { digestTemplate = t }(digestTemplate)
+	if err := loadStaffDigest("", "7", "../../"+defaultDigestTemplate, true); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	var loaded []*hub
+	for _, cfg := range []hubConfig{
+		{Name: "Alakahia", Source: "csv", SourceFile: filepath.Join(dir, "missing.csv")},
+		{
+			Name: "Lekki", Source: "csv", SourceFile: csvPath, ReminderOffsets: "3",
+			SenderName: "SprintHub Lekki", ReplyTo: "lekki@sprinthub.com.ng", StaffEmails: "desk@lekki.example.com",
+			Brand: brand{Name: "SprintHub Lekki", Color: "#0033aa"},
+		},
+	} {
+		cfg.LedgerFile = filepath.Join(dir, hubSlug(cfg.Name)+".ledger")
+		cfg.DeadLetterFile = filepath.Join(dir, hubSlug(cfg.Name)+".json")
+		h, err := newHub(cfg, false, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		defer h.sentLedger.Close()
+		h.mail = fake
+		loaded = append(loaded, h)
+	}
+	// A hub that panics doesn't stop the others either
+	hubs = append(loaded, &hub{name: "Broken"})
+	defer func() { hubs = nil }()
+
+	reports := runHubs(context.Background())
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 hub reports, Got: %+v", reports)
+	}
+	if reports[0].Hub != "Alakahia" || reports[0].Error == "" || reports[0].runReport != nil {
+		t.Errorf("Expected Alakahia to fail, Got: %+v", reports[0])
+	}
+	if reports[1].Hub != "Lekki" || reports[1].Error != "" || reports[1].EmailsSent != 1 || !reports[1].DigestSent {
+		t.Errorf("Expected Lekki to send 1 email and its digest, Got: %+v", reports[1])
+	}
+	if reports[2].Error == "" {
+		t.Errorf("Expected the broken hub to fail, Got: %+v", reports[2])
+	}
+	if len(fake.sent) != 2 {
+		t.Fatalf("Expected a reminder and a digest, Got: %+v", fake.sent)
+	}
+	if digest := fake.sent[1]; digest.ToEmail != "desk@lekki.example.com" || !strings.HasPrefix(digest.Subject, "Lekki: ") {
+		t.Errorf("Expected Lekki's digest to go to its own staff, Got: %s %q", digest.ToEmail, digest.Subject)
+	}
+	msg := fake.sent[0]
+	if msg.FromName != "SprintHub Lekki" || msg.ReplyTo != "lekki@sprinthub.com.ng" || !strings.Contains(msg.Text, "Your SprintHub Lekki co-working") {
+		t.Errorf("Expected an email from SprintHub Lekki, Got: %+v", msg)
+	}
+	for _, expected := range []string{"background:#0033aa", defaultBrand.LogoURL, "SprintHub Lekki Co-Working Space"} {
+		if !strings.Contains(msg.HTML, expected) {
+			t.Errorf("Expected the email to contain %q", expected)
+		}
+	}
+	// Each hub keeps its own ledger
+	if _, err := os.Stat(filepath.Join(dir, "lekki.ledger")); err != nil {
+		t.Errorf("Expected Lekki's ledger file, Got: %v", err)
+	}
+
+	// The cron request fails when any hub does, and still reports every hub
+	cronHeader = "secret"
+	for _, data := range []struct {
+		hubs     []*hub
+		expected int
+	}{
+		{hubs: hubs, expected: http.StatusInternalServerError},
+		{hubs: loaded[1:], expected: http.StatusOK},
+	} {
+		hubs = data.hubs
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+		rec := httptest.NewRecorder()
+		cronPingHandler(rec, req)
+		var body struct {
+			Hubs []struct{ Hub, Error string }
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != data.expected || len(body.Hubs) != len(data.hubs) {
+			t.Errorf("Expected status %d with %d hub reports, Got: %d %+v", data.expected, len(data.hubs), rec.Code, body.Hubs)
+		}
+	}
+
+	// A bad as-of date is rejected once, before any hub plans
+	req := httptest.NewRequest(http.MethodGet, "/?dry_run=true&as_of=01/05/2024", nil)
+	req.Header.Set("X-SPRINTHUB-CRON", cronHeader)
+	rec := httptest.NewRecorder()
+	cronPingHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad as-of date, Got: %d %s", http.StatusBadRequest, rec.Code, rec.Body)
+	}
+}
+
+func TestLoadHubs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configs := []hubConfig{
+		{Name: "Alakahia", Source: "csv", SourceFile: "alakahia.csv", LedgerFile: filepath.Join(dir, "missing", "alakahia.ledger")},
+		{Name: "Lekki", Source: "csv", SourceFile: "lekki.csv", LedgerFile: filepath.Join(dir, "lekki.ledger")},
+		{Name: "Yaba", Source: "csv", SourceFile: "yaba.csv", ReminderOffsets: "soon"},
+	}
+	loaded, problems := loadHubs(configs, false, false)
+	if loaded != nil {
+		t.Errorf("Expected no hubs, Got: %+v", loaded)
+	}
+	expected := []string{"Hub Alakahia", "Hub Yaba"}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, Got: %q", len(expected), problems)
+	}
+	for i, e := range expected {
+		if !strings.HasPrefix(problems[i], e) {
+			t.Errorf("Problem %d\n\tExpected: %s..., Got: %s\n", i, e, problems[i])
+		}
+	}
+}
+
+func TestNewHubMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testCases := map[string]struct {
+		Mail        mailConfig
+		ExpectError bool
+		ExpectedDir string
+	}{
+		"Global settings by default": {ExpectedDir: "global"},
+		"Own mail directory":         {Mail: mailConfig{Dir: filepath.Join(dir, "lekki")}, ExpectedDir: "lekki"},
+		"Own SendGrid account":       {Mail: mailConfig{Backend: "sendgrid", SendGridAPIKey: "SG.lekki"}},
+		"SendGrid without a key":     {Mail: mailConfig{Backend: "sendgrid"}, ExpectError: true},
+		"SMTP without an address":    {Mail: mailConfig{Backend: "smtp"}, ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		envy.Temp(func() {
+			envy.Set("MAILER", "file")
+			envy.Set("MAIL_DIR", filepath.Join(dir, "global"))
+			cfg := hubConfig{
+				Name: "Lekki", Source: "csv", SourceFile: filepath.Join(dir, "lekki.csv"), Mail: data.Mail,
+				LedgerFile: filepath.Join(dir, "lekki.ledger"), DeadLetterFile: filepath.Join(dir, "lekki.json"),
+			}
+			h, err := newHub(cfg, false, true)
+			if data.ExpectError {
+				if err == nil {
+					t.Errorf("%s\n\tExpected an error\n", testcase)
+					h.sentLedger.Close()
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s\n\tUnexpected error: %+v\n", testcase, err)
+			}
+			defer h.sentLedger.Close()
+			if h.mail == nil {
+				t.Fatalf("%s\n\tExpected the hub to have a mailer\n", testcase)
+			}
+			if data.ExpectedDir == "" {
+				return
+			}
+			if _, err := h.mail.Send(mailer.Message{FromEmail: "lekki@sprinthub.com.ng", ToEmail: "ada@example.com"}); err != nil {
+				t.Fatalf("%s\n\tUnexpected error: %+v\n", testcase, err)
+			}
+			files, err := ioutil.ReadDir(filepath.Join(dir, data.ExpectedDir))
+			if err != nil || len(files) == 0 {
+				t.Errorf("%s\n\tExpected an email in %s, Got: %v\n", testcase, data.ExpectedDir, err)
+			}
+			os.RemoveAll(filepath.Join(dir, data.ExpectedDir))
+		})
+	}
+}
+
+// panicMailer panics on every send
+type panicMailer struct{}
+
+func (panicMailer) Send(msg mailer.Message) (string, error) {
+	panic("mailer is broken")
+}
+
+func TestRunRecoversSendPanics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	due := time.Now().In(sheetdata.DefaultLocation()).AddDate(0, 0, 3).Format("02/01/06")
+	csvPath := filepath.Join(dir, "yaba.csv")
+	if err := ioutil.WriteFile(csvPath, []byte("First Name,Email,End Date\nAda,ada@example.com,"+due+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emailTemplates[defaultTemplate] = template.Must(parseEmailTemplate("../../"+defaultTemplate, false))
+	h, err := newHub(hubConfig{
+		Name: "Yaba", Source: "csv", SourceFile: csvPath, ReminderOffsets: "3",
+		LedgerFile: filepath.Join(dir, "yaba.ledger"), DeadLetterFile: filepath.Join(dir, "yaba.json"),
+	}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	defer h.sentLedger.Close()
+	h.mail = panicMailer{}
+	// The panic happens on a pool worker, where isolate can't recover it
+	report, err := h.run(context.Background(), sheetdata.SystemClock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if report.EmailsSent != 0 || len(report.SendFailures) != 1 || !strings.Contains(report.SendFailures[0].Error, "mailer is broken") {
+		t.Errorf("Expected the send to fail, Got: %+v", report)
+	}
+}
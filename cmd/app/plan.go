@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
+	"github.com/pkg/errors"
+)
+
+// runPlan lists the reminders a run sends and the rows it skips
+type runPlan struct {
+	DryRun        bool         `json:"dry_run"`
+	AsOf          string       `json:"as_of"`
+	RowsRead      int          `json:"rows_read"`
+	Recipients    []recipient  `json:"recipients"`
+	Skipped       []skipped    `json:"skipped"`
+	ParseFailures []rowFailure `json:"parse_failures"`
+	// States counts the subscribers in each lifecycle state
+	States map[reminder.State]int `json:"states"`
+	// Digest is the staff digest the run would send, if there is a staff list
+	Digest *staffDigest `json:"digest,omitempty"`
+
+	// Column the outcome of each reminder is written to, if the sheet has one
+	statusColumn    int
+	hasStatusColumn bool
+	// clock tells the time the plan was made for
+	clock sheetdata.Clock
+	// Dead letters that no longer need retrying, because the reminder was sent or the row has changed
+	staleLetters []ledger.Key
+	// Dead letters that are given up on, because they failed too many times or for too long
+	expiredLetters []ledger.DeadLetter
+	// Every subscriber that could be read, for the staff digest
+	subscribers []parsedRow
+}
+
+// recipient is a subscriber due for a reminder
+type recipient struct {
+	Row   int    `json:"row"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Cc are the other addresses in the row's email cell, which get a copy
+	Cc       []string `json:"cc,omitempty"`
+	DaysLeft int      `json:"days_left"`
+	// Plan is the subscriber's plan, if the sheet has a plan column
+	Plan string `json:"plan,omitempty"`
+	// State is where the subscription is in its lifecycle, e.g. "grace"
+	State    reminder.State `json:"state"`
+	Subject  string         `json:"subject"`
+	Template string         `json:"template"`
+	// Retry is set for a reminder that failed in an earlier run
+	Retry bool `json:"retry,omitempty"`
+
+	entry    sheetdata.SheetEntry
+	reminder reminder.Reminder
+	// letter is the dead letter of a reminder being retried
+	letter *ledger.DeadLetter
+}
+
+// skipped is a row that gets no email, with the reason why
+type skipped struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+// rowFailure is a row that couldn't be parsed
+type rowFailure struct {
+	Row    int    `json:"row"`
+	Reason string `json:"reason"`
+}
+
+// planReminders evaluates every row of the sheet against the reminder policy and the ledger as of the time
+// given by clock. The first row holds the column headers and is at start in the sheet.
+// Reminders in the dead letter list come first, so they are retried before any new ones.
+func (h *hub) planReminders(values [][]interface{}, start source.RangeStart, clock sheetdata.Clock) (*runPlan, error) {
+	if len(values) == 0 {
+		return nil, errors.New("Missing sheets data")
+	}
+	parser, err := sheetdata.NewParser(values[0], sheetdata.Options{
+		Aliases:     headerAliases,
+		DateLayouts: dateLayouts,
+		FirstColumn: start.Column,
+		Location:    hubLocation,
+		Clock:       clock,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan := &runPlan{
+		AsOf:          clock.Now().In(hubLocation).Format("2006-01-02"),
+		RowsRead:      len(values) - 1,
+		Recipients:    []recipient{},
+		Skipped:       []skipped{},
+		ParseFailures: []rowFailure{},
+		States:        map[reminder.State]int{},
+		clock:         clock,
+	}
+	if column, ok := parser.Column(sheetdata.FieldReminderStatus); ok {
+		plan.statusColumn, plan.hasStatusColumn = start.Column+column, true
+	}
+	var rows []parsedRow
+	// planned maps the reminders planned so far to their rows, so a subscriber on two rows gets one reminder
+	planned := map[string]int{}
+	for i, row := range values[1:] {
+		rowNum := start.Row + i + 1
+		data, err := parser.NewSheetEntry(rowNum, row)
+		if err == sheetdata.ErrBlankRow {
+			// Blank rows aren't subscribers, so they don't count as read
+			plan.RowsRead--
+			continue
+		}
+		if err != nil {
+			plan.ParseFailures = append(plan.ParseFailures, rowFailure{
+				Row:    rowNum,
+				Reason: errors.WithMessage(err, "Failed to parse data from spreadsheet.").Error(),
+			})
+			continue
+		}
+		rows = append(rows, parsedRow{num: rowNum, entry: data})
+		plan.States[lifecycle.State(data.DaysLeft())]++
+		// Determine whether a reminder is scheduled for the days left
+		p := h.policyFor(data)
+		r, ok := p.Due(data, clock)
+		if ok && !p.Sends(reminder.ChannelEmail) {
+			plan.Skipped = append(plan.Skipped, skipped{
+				Row:    rowNum,
+				Email:  data.Email,
+				Reason: fmt.Sprintf("The %s plan gets no reminder emails", data.Plan),
+			})
+			continue
+		}
+		if !ok {
+			plan.Skipped = append(plan.Skipped, skipped{
+				Row:    rowNum,
+				Email:  data.Email,
+				Reason: fmt.Sprintf("No reminder scheduled for %d days left", data.DaysLeft()),
+			})
+			continue
+		}
+		key := reminderKey(data, r.Offset)
+		if first, ok := planned[key.String()]; ok {
+			plan.Skipped = append(plan.Skipped, skipped{
+				Row:    rowNum,
+				Email:  data.Email,
+				Reason: fmt.Sprintf("Reminder for %d days left already planned for row %d", r.Offset, first),
+			})
+			continue
+		}
+		sent, err := h.sentLedger.Has(key)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Unable to read the reminder ledger")
+		}
+		if sent {
+			plan.Skipped = append(plan.Skipped, skipped{
+				Row:    rowNum,
+				Email:  data.Email,
+				Reason: fmt.Sprintf("Reminder for %d days left already sent", r.Offset),
+			})
+			continue
+		}
+		planned[key.String()] = rowNum
+		plan.Recipients = append(plan.Recipients, newRecipient(rowNum, data, r))
+	}
+	plan.subscribers = rows
+	retries, err := h.planRetries(plan, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(retries) > 0 {
+		retried, retriedRows := map[string]bool{}, map[int]bool{}
+		for _, rcpt := range retries {
+			retried[rcpt.key().String()] = true
+			retriedRows[rcpt.Row] = true
+		}
+		for _, rcpt := range plan.Recipients {
+			if !retried[rcpt.key().String()] {
+				retries = append(retries, rcpt)
+			}
+		}
+		plan.Recipients = retries
+		// A row being retried isn't skipped, even if no new reminder is due for it
+		kept := plan.Skipped[:0]
+		for _, s := range plan.Skipped {
+			if !retriedRows[s.Row] {
+				kept = append(kept, s)
+			}
+		}
+		plan.Skipped = kept
+	}
+	return plan, nil
+}
+
+// parsedRow is a subscriber read from the sheet and the row it is on
+type parsedRow struct {
+	num   int
+	entry sheetdata.SheetEntry
+}
+
+func newRecipient(row int, data sheetdata.SheetEntry, r reminder.Reminder) recipient {
+	return recipient{
+		Row:      row,
+		Name:     data.FullName(),
+		Email:    data.Email,
+		Cc:       data.Emails[1:],
+		DaysLeft: data.DaysLeft(),
+		Plan:     data.Plan,
+		State:    lifecycle.State(data.DaysLeft()),
+		Subject:  r.Subject,
+		Template: r.Template,
+		entry:    data,
+		reminder: r,
+	}
+}
+
+// key identifies the reminder in the ledger and the dead letter list
+func (rcpt recipient) key() ledger.Key {
+	return reminderKey(rcpt.entry, rcpt.reminder.Offset)
+}
+
+// reminderKey identifies the reminder at offset to a subscriber
+func reminderKey(data sheetdata.SheetEntry, offset int) ledger.Key {
+	return ledger.Key{Email: data.Email, EndDate: data.EndDate, Offset: offset}
+}
+
+// planRetries turns the dead letters into recipients. A dead letter is only retried while the sheet still has a row
+// with its email and end date, the reminder is still scheduled and it hasn't been sent since; otherwise it is stale.
+// It is given up on once it has failed deadLetterAttempts times, or first failed more than deadLetterMaxAge ago.
+func (h *hub) planRetries(plan *runPlan, rows []parsedRow) ([]recipient, error) {
+	letters, err := h.deadLetters.List()
+	if err != nil {
+		return nil, err
+	}
+	retries := make([]recipient, 0, len(letters))
+	for i, letter := range letters {
+		if letter.Attempts >= deadLetterAttempts || plan.clock.Now().Sub(letter.Since()) > deadLetterMaxAge {
+			plan.expiredLetters = append(plan.expiredLetters, letter)
+			continue
+		}
+		var row *parsedRow
+		for i := range rows {
+			if reminderKey(rows[i].entry, letter.Offset).String() == letter.Key.String() {
+				row = &rows[i]
+				break
+			}
+		}
+		if row == nil {
+			plan.staleLetters = append(plan.staleLetters, letter.Key)
+			continue
+		}
+		p := h.policyFor(row.entry)
+		r, scheduled := p.Reminder(letter.Offset)
+		if !scheduled || !p.Sends(reminder.ChannelEmail) {
+			plan.staleLetters = append(plan.staleLetters, letter.Key)
+			continue
+		}
+		sent, err := h.sentLedger.Has(letter.Key)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Unable to read the reminder ledger")
+		}
+		if sent {
+			plan.staleLetters = append(plan.staleLetters, letter.Key)
+			continue
+		}
+		rcpt := newRecipient(row.num, row.entry, r)
+		rcpt.Retry = true
+		rcpt.letter = &letters[i]
+		retries = append(retries, rcpt)
+	}
+	return retries, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/ledger"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/source"
+	"github.com/pkg/errors"
+)
+
+func TestPlanReminders(t *testing.T) {
+	policy = reminder.NewPolicy(reminder.Reminder{Offset: 7, Subject: "A week left", Template: defaultTemplate})
+	store := ledger.NewMemoryStore()
+	sentLedger = store
+	deadLetters = &ledger.MemoryDeadLetters{}
+	clock := sheetdata.FixedClock(time.Date(2024, time.April, 24, 12, 0, 0, 0, sheetdata.DefaultLocation()))
+	due, later := "01/05/24", "15/05/24"
+	values := [][]interface{}{
+		{"First Name", "Last Name", "Phone", "Email", "End Date"},
+		{"Ada", "Obi", "0800", "ada@example.com", due},
+		{"Bola", "Ade", "0801", "bola@example.com", later},
+		{"Chidi", "Eze", "0802", "", due},
+		{"Dayo", "Ola", "0803", "dayo@example.com", due},
+		{},
+		{"Emeka", "Nwosu"},
+	}
+	sentDate, _ := time.Parse("02/01/06", due)
+	store.Record(ledger.Entry{Key: ledger.Key{Email: "dayo@example.com", EndDate: sentDate, Offset: 7}})
+
+	plan, err := envHub().planReminders(values, source.RangeStart{Row: 1}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(plan.Recipients) != 1 {
+		t.Fatalf("Expected 1 recipient, Got: %+v", plan.Recipients)
+	}
+	if got := plan.Recipients[0]; got.Row != 2 || got.Email != "ada@example.com" || got.DaysLeft != 7 || got.Subject != "A week left" {
+		t.Errorf("Unexpected recipient %+v", got)
+	}
+	if plan.Recipients[0].State != reminder.Expiring || plan.States[reminder.Expiring] != 2 || plan.States[reminder.Active] != 1 {
+		t.Errorf("Expected 2 expiring and 1 active subscriptions, Got: %v", plan.States)
+	}
+	if plan.AsOf != "2024-04-24" {
+		t.Errorf("Expected the plan to be as of 2024-04-24, Got: %s", plan.AsOf)
+	}
+	// The blank row isn't counted and the short row fails on its email cell
+	if plan.RowsRead != 5 || len(plan.ParseFailures) != 2 || plan.ParseFailures[0].Row != 4 || plan.ParseFailures[1].Row != 7 ||
+		!strings.Contains(plan.ParseFailures[1].Reason, "D7") {
+		t.Errorf("Expected 5 rows read and parse failures on rows 4 and 7, Got: %d %+v", plan.RowsRead, plan.ParseFailures)
+	}
+	// Row numbers and cells follow the start of READ_RANGE, e.g. "Members!C3:G"
+	offset, err := envHub().planReminders(values, source.RangeStart{Sheet: "Members!", Row: 3, Column: 2}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if f := offset.ParseFailures[1]; f.Row != 9 || !strings.Contains(f.Reason, "F9") {
+		t.Errorf("Expected a parse failure in cell F9, Got: %+v", f)
+	}
+	expectedSkips := map[int]string{3: "bola@example.com", 5: "dayo@example.com"}
+	if len(plan.Skipped) != len(expectedSkips) {
+		t.Fatalf("Expected %d skipped rows, Got: %+v", len(expectedSkips), plan.Skipped)
+	}
+	for _, s := range plan.Skipped {
+		if email, ok := expectedSkips[s.Row]; !ok || email != s.Email || s.Reason == "" {
+			t.Errorf("Unexpected skipped row %+v", s)
+		}
+	}
+}
+
+func TestPlanRemindersDuplicateRows(t *testing.T) {
+	policy = reminder.NewPolicy(reminder.Reminder{Offset: 7, Subject: "A week left", Template: defaultTemplate})
+	sentLedger = ledger.NewMemoryStore()
+	deadLetters = &ledger.MemoryDeadLetters{}
+	clock := sheetdata.FixedClock(time.Date(2024, time.April, 24, 12, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Email", "End Date"},
+		{"Ada", "ada@example.com", "01/05/24"},
+		{"Bola", "bola@example.com", "01/05/24"},
+		{"Ada", "ada@example.com", "01/05/24"},
+	}
+	plan, err := envHub().planReminders(values, source.RangeStart{Row: 1}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(plan.Recipients) != 2 || plan.Recipients[0].Row != 2 || plan.Recipients[1].Row != 3 {
+		t.Errorf("Expected rows 2 and 3 to get a reminder, Got: %+v", plan.Recipients)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Row != 4 || !strings.Contains(plan.Skipped[0].Reason, "row 2") {
+		t.Errorf("Expected row 4 to be skipped as a duplicate of row 2, Got: %+v", plan.Skipped)
+	}
+}
+
+func TestPlanRemindersByPlan(t *testing.T) {
+	policy = reminder.NewPolicy(reminder.Reminder{Offset: 7, Subject: "A week left", Template: defaultTemplate})
+	weekly := reminder.NewPolicy(reminder.Reminder{Offset: 2, Subject: "Two days left", Template: defaultTemplate})
+	daily := reminder.NewPolicy(reminder.Reminder{Offset: 2, Template: defaultTemplate})
+	daily.Channels = nil
+	planPolicies = map[string]reminder.Policy{"weekly": weekly, "daily": daily}
+	defer func() { planPolicies = map[string]reminder.Policy{} }()
+	sentLedger = ledger.NewMemoryStore()
+	deadLetters = &ledger.MemoryDeadLetters{}
+	clock := sheetdata.FixedClock(time.Date(2024, time.April, 24, 12, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Email", "End Date", "Plan"},
+		{"Ada", "ada@example.com", "01/05/24", "Monthly"},
+		{"Bola", "bola@example.com", "01/05/24", "Weekly"},
+		{"Chidi", "chidi@example.com", "26/04/24", "weekly"},
+		{"Dayo", "dayo@example.com", "26/04/24", "Daily"},
+		{"Emeka", "emeka@example.com", "01/05/24"},
+	}
+	plan, err := envHub().planReminders(values, source.RangeStart{Row: 1}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	// Unknown and missing plans get the default schedule
+	expected := map[int]string{2: "A week left", 4: "Two days left", 6: "A week left"}
+	if len(plan.Recipients) != len(expected) {
+		t.Fatalf("Expected %d recipients, Got: %+v", len(expected), plan.Recipients)
+	}
+	for _, rcpt := range plan.Recipients {
+		if subject, ok := expected[rcpt.Row]; !ok || rcpt.Subject != subject {
+			t.Errorf("Unexpected recipient %+v", rcpt)
+		}
+	}
+	if plan.Recipients[1].Plan != "weekly" {
+		t.Errorf("Expected the weekly plan, Got: %q", plan.Recipients[1].Plan)
+	}
+	if len(plan.Skipped) != 2 || plan.Skipped[1].Row != 5 || !strings.Contains(plan.Skipped[1].Reason, "daily plan") {
+		t.Errorf("Expected rows 3 and 5 to be skipped, Got: %+v", plan.Skipped)
+	}
+}
+
+func TestPlanRetries(t *testing.T) {
+	policy = reminder.NewPolicy(
+		reminder.Reminder{Offset: 7, Subject: "A week left", Template: defaultTemplate},
+		reminder.Reminder{Offset: 3, Subject: "3 days left", Template: defaultTemplate},
+	)
+	sentLedger = ledger.NewMemoryStore()
+	letters := &ledger.MemoryDeadLetters{}
+	deadLetters = letters
+	clock := sheetdata.FixedClock(time.Date(2024, time.April, 24, 12, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Email", "End Date"},
+		{"Ada", "ada@example.com", "01/05/24"},
+		{"Bola", "bola@example.com", "28/04/24"},
+		{"Chidi", "chidi@example.com", "01/06/24"},
+		{"Dayo", "dayo@example.com", "28/04/24"},
+		{"Emeka", "emeka@example.com", "28/04/24"},
+	}
+	date := func(day string) time.Time {
+		d, _ := time.Parse("02/01/06", day)
+		return d
+	}
+	// Bola's 3 day reminder failed yesterday; Chidi has renewed since that reminder failed. Dayo's has failed too
+	// many times and Emeka's has been failing for too long.
+	yesterday := clock.Now().AddDate(0, 0, -1)
+	letters.Add(ledger.DeadLetter{Key: ledger.Key{Email: "bola@example.com", EndDate: date("28/04/24"), Offset: 3}, FailedAt: yesterday, Attempts: 1})
+	letters.Add(ledger.DeadLetter{Key: ledger.Key{Email: "chidi@example.com", EndDate: date("01/05/24"), Offset: 7}, FailedAt: yesterday, Attempts: 1})
+	letters.Add(ledger.DeadLetter{Key: ledger.Key{Email: "dayo@example.com", EndDate: date("28/04/24"), Offset: 3}, FailedAt: yesterday, Attempts: deadLetterAttempts})
+	letters.Add(ledger.DeadLetter{
+		Key:           ledger.Key{Email: "emeka@example.com", EndDate: date("28/04/24"), Offset: 3},
+		FailedAt:      yesterday,
+		FirstFailedAt: clock.Now().AddDate(0, 0, -4),
+		Attempts:      1,
+	})
+
+	plan, err := envHub().planReminders(values, source.RangeStart{Row: 1}, clock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(plan.Recipients) != 2 {
+		t.Fatalf("Expected 2 recipients, Got: %+v", plan.Recipients)
+	}
+	if got := plan.Recipients[0]; got.Email != "bola@example.com" || !got.Retry || got.Subject != "3 days left" || got.DaysLeft != 4 || got.letter.Attempts != 1 {
+		t.Errorf("Expected the retry first, Got: %+v", got)
+	}
+	if got := plan.Recipients[1]; got.Email != "ada@example.com" || got.Retry {
+		t.Errorf("Unexpected recipient %+v", got)
+	}
+	if len(plan.Skipped) != 3 || plan.Skipped[0].Email != "chidi@example.com" {
+		t.Errorf("Expected chidi@example.com, dayo@example.com and emeka@example.com to be skipped, Got: %+v", plan.Skipped)
+	}
+	if len(plan.staleLetters) != 1 || plan.staleLetters[0].Email != "chidi@example.com" {
+		t.Errorf("Expected the dead letter for chidi@example.com to be stale, Got: %+v", plan.staleLetters)
+	}
+	if len(plan.expiredLetters) != 2 || plan.expiredLetters[0].Email != "dayo@example.com" || plan.expiredLetters[1].Email != "emeka@example.com" {
+		t.Errorf("Expected to give up on the dead letters for dayo@example.com and emeka@example.com, Got: %+v", plan.expiredLetters)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	plan := &runPlan{
+		RowsRead:      5,
+		Recipients:    []recipient{{Row: 2, Email: "ada@example.com"}, {Row: 3, Email: "bola@example.com"}},
+		Skipped:       []skipped{{Row: 4}},
+		ParseFailures: []rowFailure{{Row: 5, Reason: "Bad time value"}, {Row: 6, Reason: "Unexpected email value"}},
+	}
+	report := newRunReport(plan)
+	report.sent()
+	report.failed(plan.Recipients[1], errors.New("401 Unauthorized"))
+	if report.RowsParsed != 3 || report.EmailsSent != 1 || report.EmailsSkipped != 1 || report.ProviderRejections != 0 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+	if len(report.SendFailures) != 1 || report.SendFailures[0].Row != 3 || report.SendFailures[0].Error != "401 Unauthorized" {
+		t.Errorf("Unexpected send failures %+v", report.SendFailures)
+	}
+	// Failures the mail provider refused are counted separately
+	report.failed(plan.Recipients[0], &mailer.ResponseError{Code: 400})
+	report.failed(plan.Recipients[0], &mailer.ResponseError{Code: 503})
+	if report.ProviderRejections != 1 {
+		t.Errorf("Expected 1 provider rejection, Got: %d", report.ProviderRejections)
+	}
+}
+
+// fakeStatusSource serves fixed rows and records status updates
+type fakeStatusSource struct {
+	rows    [][]interface{}
+	updates []source.StatusUpdate
+}
+
+func (f *fakeStatusSource) Rows(ctx context.Context) ([][]interface{}, error) {
+	return f.rows, nil
+}
+
+func (f *fakeStatusSource) WriteStatus(ctx context.Context, updates []source.StatusUpdate) error {
+	f.updates = append(f.updates, updates...)
+	return nil
+}
+
+func TestWriteStatus(t *testing.T) {
+	src := &fakeStatusSource{}
+	subscribers = src
+	plan := &runPlan{
+		Recipients:      []recipient{{Row: 2, reminder: reminder.Reminder{Offset: 3}}, {Row: 5, reminder: reminder.Reminder{Offset: -1}}},
+		statusColumn:    6,
+		hasStatusColumn: true,
+		clock:           sheetdata.FixedClock(time.Date(2024, time.April, 30, 23, 30, 0, 0, time.UTC)),
+	}
+	if err := envHub().writeStatus(context.Background(), plan, []string{"sent", "failed: 401 Unauthorized"}); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	// 23:30 UTC is already the next day in Lagos
+	today := "2024-05-01"
+	expected := []source.StatusUpdate{
+		{Row: 2, Column: 6, Value: today + ": 3 days left reminder sent"},
+		{Row: 5, Column: 6, Value: today + ": expired 1 day ago reminder failed: 401 Unauthorized"},
+	}
+	if !reflect.DeepEqual(src.updates, expected) {
+		t.Errorf("Expected: %+v, Got: %+v", expected, src.updates)
+	}
+	// Rows whose send never started keep their last status
+	src.updates = nil
+	if err := envHub().writeStatus(context.Background(), plan, []string{"sent", ""}); err != nil || !reflect.DeepEqual(src.updates, expected[:1]) {
+		t.Errorf("Expected: %+v, Got: %+v (%v)", expected[:1], src.updates, err)
+	}
+	// Nothing is written when the sheet has no status column
+	src.updates = nil
+	plan.hasStatusColumn = false
+	if err := envHub().writeStatus(context.Background(), plan, []string{"sent", "sent"}); err != nil || len(src.updates) != 0 {
+		t.Errorf("Expected no updates, Got: %+v (%v)", src.updates, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/mailer"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+)
+
+// runReport summarises a cron run for monitoring
+type runReport struct {
+	RowsRead      int           `json:"rows_read"`
+	RowsParsed    int           `json:"rows_parsed"`
+	ParseFailures []rowFailure  `json:"parse_failures"`
+	EmailsSent    int           `json:"emails_sent"`
+	EmailsSkipped int           `json:"emails_skipped"`
+	SendFailures  []sendFailure `json:"send_failures"`
+	// States counts the subscribers in each lifecycle state
+	States map[reminder.State]int `json:"states"`
+	// ProviderRejections counts the send failures where the mail provider refused the message
+	ProviderRejections int `json:"provider_rejections"`
+	// EmailsCancelled counts the emails not sent because the run was cancelled first
+	EmailsCancelled int `json:"emails_cancelled"`
+	// DigestSent is set if the staff digest was sent by this run, and DigestError if sending it failed
+	DigestSent  bool   `json:"digest_sent"`
+	DigestError string `json:"digest_error,omitempty"`
+	// StatusError is set if the outcomes could not be written back to the sheet
+	StatusError string `json:"status_error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// sendFailure is a reminder that could not be sent, with the error from the mail provider
+type sendFailure struct {
+	Row   int    `json:"row"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+// newRunReport starts a report from the plan of a run
+func newRunReport(plan *runPlan) *runReport {
+	return &runReport{
+		RowsRead:      plan.RowsRead,
+		RowsParsed:    plan.RowsRead - len(plan.ParseFailures),
+		ParseFailures: plan.ParseFailures,
+		EmailsSkipped: len(plan.Skipped),
+		SendFailures:  []sendFailure{},
+		States:        plan.States,
+	}
+}
+
+// sent counts a successful send. It is safe for concurrent use.
+func (r *runReport) sent() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EmailsSent++
+}
+
+// failed records a failed send. It is safe for concurrent use.
+func (r *runReport) failed(rcpt recipient, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SendFailures = append(r.SendFailures, sendFailure{Row: rcpt.Row, Email: rcpt.Email, Error: err.Error()})
+	if mailer.Rejected(err) {
+		r.ProviderRejections++
+	}
+}
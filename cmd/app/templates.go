@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Layout shared by the templates in TEMPLATE_DIR. It renders the "content" block of the reminder's template.
+	layoutTemplate = "layout.html"
+	// Template in TEMPLATE_DIR of the stages that don't have their own
+	fallbackStage = "reminder"
+)
+
+var (
+	// Directory of the email templates, TEMPLATE_DIR: a layout and a template for each stage. Empty to use a
+	// single template file.
+	templateDir string
+	// Helpers available to the email and digest templates
+	templateFuncs = template.FuncMap{
+		"reminderName": reminderName,
+		"days":         pluralDays,
+		"date":         formatDate,
+		"addDays": func(days int, t time.Time) time.Time {
+			return t.AddDate(0, 0, days)
+		},
+		"currency": formatCurrency,
+		"naira": func(amount interface{}) (string, error) {
+			return formatCurrency("₦", amount)
+		},
+	}
+)
+
+// stageName names the template of a reminder in TEMPLATE_DIR, e.g. "7-day", "today", "3-days-after", "expired",
+// "grace-ending" or "win-back"
+func stageName(r reminder.Reminder) string {
+	switch {
+	case r.Stage != "":
+		return strings.Replace(r.Stage, "_", "-", -1)
+	case r.Offset == 0:
+		return "today"
+	case r.Offset < 0:
+		return fmt.Sprintf("%d-days-after", -r.Offset)
+	}
+	return fmt.Sprintf("%d-day", r.Offset)
+}
+
+// stageTemplate returns the template of a reminder that doesn't configure one: its stage's template in
+// TEMPLATE_DIR, or reminder.html if there is none, or the default template without a directory
+func stageTemplate(r reminder.Reminder) string {
+	if templateDir == "" {
+		return defaultTemplate
+	}
+	file := filepath.Join(templateDir, stageName(r)+".html")
+	if _, err := os.Stat(file); err != nil {
+		fallback := filepath.Join(templateDir, fallbackStage+".html")
+		if _, err := os.Stat(fallback); err == nil {
+			return fallback
+		}
+	}
+	return file
+}
+
+// parseEmailTemplate parses an email template file. A stage template, one in TEMPLATE_DIR picked by
+// stageTemplate, defines the "content" block, and may override the "title" block, of the directory's layout.
+// Any other template is used as it is.
+func parseEmailTemplate(file string, stage bool) (*template.Template, error) {
+	if !stage || templateDir == "" || filepath.Dir(file) != filepath.Clean(templateDir) {
+		return template.New(filepath.Base(file)).Funcs(templateFuncs).ParseFiles(file)
+	}
+	t, err := template.New(layoutTemplate).Funcs(templateFuncs).ParseFiles(filepath.Join(templateDir, layoutTemplate), file)
+	if err != nil {
+		return nil, err
+	}
+	if t.Lookup("content") == nil {
+		return nil, errors.Errorf("%s has no {{ define \"content\" }} block", file)
+	}
+	return t, nil
+}
+
+// loadEmailTemplates parses the template of every reminder of the hubs, and every template in TEMPLATE_DIR, and
+// renders each for a sample subscriber so that mistakes show at startup rather than when a reminder is due.
+// Every problem found is returned.
+func loadEmailTemplates(hubs []*hub) []string {
+	var problems []string
+	check := func(h *hub, r reminder.Reminder, stage bool) {
+		if _, checked := emailTemplates[r.Template]; checked {
+			return
+		}
+		t, err := parseEmailTemplate(r.Template, stage)
+		if err == nil {
+			values, _ := h.emailData(sampleEntry(r), r)
+			err = t.Execute(ioutil.Discard, values)
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		emailTemplates[r.Template] = t
+	}
+	for _, h := range hubs {
+		for _, p := range h.policies() {
+			for _, offset := range p.Offsets() {
+				r, _ := p.Reminder(offset)
+				check(h, r, r.Template == stageTemplate(r))
+			}
+		}
+	}
+	if templateDir != "" {
+		files, err := filepath.Glob(filepath.Join(templateDir, "*.html"))
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			if filepath.Base(file) != layoutTemplate {
+				check(hubs[0], reminder.Reminder{Offset: 7, Template: file}, true)
+			}
+		}
+	}
+	for file, t := range emailTemplates {
+		if t == nil {
+			delete(emailTemplates, file)
+		}
+	}
+	return problems
+}
+
+// sampleEntry is a subscriber that reminder r is due for, used to check templates
+func sampleEntry(r reminder.Reminder) sheetdata.SheetEntry {
+	today := time.Now().In(hubLocation)
+	return sheetdata.SheetEntry{
+		FirstName: "Ada",
+		LastName:  "Obi",
+		Email:     "ada@example.com",
+		Emails:    []string{"ada@example.com"},
+		EndDate:   time.Date(today.Year(), today.Month(), today.Day()+r.Offset, 0, 0, 0, 0, hubLocation),
+		Plan:      "monthly",
+	}
+}
+
+// formatDate formats a time as e.g. "2 January 2006", or with a Go time layout, e.g. {{ date .EndDate "Mon 2 Jan" }}
+func formatDate(t time.Time, layout ...string) string {
+	if len(layout) > 0 {
+		return t.Format(layout[0])
+	}
+	return t.Format("2 January 2006")
+}
+
+// formatCurrency formats an amount of money with thousands separators, e.g. "₦25,000" or "₦1,250.50".
+// The amount may be a number or the text of one.
+func formatCurrency(symbol string, amount interface{}) (string, error) {
+	var value float64
+	switch v := amount.(type) {
+	case int:
+		value = float64(v)
+	case int64:
+		value = float64(v)
+	case float64:
+		value = v
+	case string:
+		var err error
+		if value, err = strconv.ParseFloat(strings.Replace(strings.TrimSpace(v), ",", "", -1), 64); err != nil {
+			return "", errors.Errorf("%q is not an amount", v)
+		}
+	default:
+		return "", errors.Errorf("%v is not an amount", amount)
+	}
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	cents := int64(math.Round(value * 100))
+	whole := strconv.FormatInt(cents/100, 10)
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if cents%100 != 0 {
+		fmt.Fprintf(&b, ".%02d", cents%100)
+	}
+	return sign + symbol + b.String(), nil
+}
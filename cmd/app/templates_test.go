@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/reminder"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/gobuffalo/envy"
+)
+
+func TestFormatCurrency(t *testing.T) {
+	testCases := map[string]struct {
+		Amount   interface{}
+		Expected string
+	}{
+		"Whole amount":    {Amount: 25000, Expected: "₦25,000"},
+		"With kobo":       {Amount: 1250.5, Expected: "₦1,250.50"},
+		"Small amount":    {Amount: int64(999), Expected: "₦999"},
+		"Millions":        {Amount: 1234567.891, Expected: "₦1,234,567.89"},
+		"Negative amount": {Amount: -1500, Expected: "-₦1,500"},
+		"Text from sheet": {Amount: "35,000", Expected: "₦35,000"},
+	}
+	for testcase, data := range testCases {
+		got, err := formatCurrency("₦", data.Amount)
+		if err != nil || got != data.Expected {
+			t.Errorf("%s\n\tExpected: %s, Got: %s %v\n", testcase, data.Expected, got, err)
+		}
+	}
+	if _, err := formatCurrency("₦", "free"); err == nil {
+		t.Errorf("Expected an error for a value that isn't an amount")
+	}
+}
+
+func TestStageTemplate(t *testing.T) {
+	templateDir = filepath.Join("..", "..", "templates")
+	defer func() { templateDir = "" }()
+	testCases := map[string]struct {
+		Reminder reminder.Reminder
+		Expected string
+	}{
+		"A week left":     {Reminder: reminder.Reminder{Offset: 7}, Expected: "7-day.html"},
+		"A day left":      {Reminder: reminder.Reminder{Offset: 1}, Expected: "1-day.html"},
+		"Expired":         {Reminder: reminder.Reminder{Offset: -1, Stage: reminder.StageExpired}, Expected: "expired.html"},
+		"Day of expiry":   {Reminder: reminder.Reminder{Offset: 0}, Expected: "reminder.html"},
+		"Grace ends soon": {Reminder: reminder.Reminder{Offset: -5, Stage: reminder.StageGraceEnding}, Expected: "reminder.html"},
+	}
+	for testcase, data := range testCases {
+		if got := stageTemplate(data.Reminder); got != filepath.Join(templateDir, data.Expected) {
+			t.Errorf("%s\n\tExpected: %s, Got: %s\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestLoadEmailTemplates(t *testing.T) {
+	templateDir = filepath.Join("..", "..", "templates")
+	defer func() { templateDir = "" }()
+	var err error
+	if policy, err = newReminderPolicy("", "7,3,1,0", ""); err != nil {
+		t.Fatal(err)
+	}
+	planPolicies = map[string]reminder.Policy{}
+	emailTemplates = map[string]*template.Template{}
+	if problems := loadEmailTemplates(allHubs()); len(problems) > 0 {
+		t.Fatalf("Unexpected problems: %q", problems)
+	}
+	r, _ := policy.Reminder(3)
+	entry := sampleEntry(r)
+	values, _ := envHub().emailData(entry, r)
+	var buf bytes.Buffer
+	if err := emailTemplates[r.Template].Execute(&buf, values); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Hi Ada,", "will expire in 3 days, on " + entry.EndDate.Format("Monday 2 January")} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected the 3 day reminder to contain %q", expected)
+		}
+	}
+	// The days left are counted on the day the email goes out, e.g. when a failed reminder is retried later
+	for _, data := range []struct {
+		offset, daysLeft int
+		expected         string
+	}{
+		{offset: 7, daysLeft: 5, expected: "ends in 5 days, on"},
+		{offset: 1, daysLeft: 0, expected: "expires today,"},
+	} {
+		r, _ := policy.Reminder(data.offset)
+		values, _ := envHub().emailData(sampleEntry(reminder.Reminder{Offset: data.daysLeft}), r)
+		buf.Reset()
+		if err := emailTemplates[r.Template].Execute(&buf, values); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), data.expected) {
+			t.Errorf("Expected the %d day reminder to contain %q", data.offset, data.expected)
+		}
+	}
+
+	// Every broken template is reported
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for file, content := range map[string]string{
+		"layout.html":   `<p>{{ template "content" . }}</p>`,
+		"reminder.html": `{{ define "content" }}{{ .TimeLeft }} left{{ end }}`,
+		"7-day.html":    `{{ define "content" }}{{ .Phone }}{{ end }}`,
+		"3-day.html":    `{{ define "contents" }}{{ .TimeLeft }}{{ end }}`,
+		"1-day.html":    `{{ define "content" }}{{ naira .Plan }}{{ end }}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templateDir = dir
+	if policy, err = newReminderPolicy("", "7,3,1,0", ""); err != nil {
+		t.Fatal(err)
+	}
+	emailTemplates = map[string]*template.Template{}
+	problems := loadEmailTemplates(allHubs())
+	for _, expected := range []string{"7-day.html", "3-day.html has no", "1-day.html"} {
+		found := false
+		for _, problem := range problems {
+			found = found || strings.Contains(problem, expected)
+		}
+		if !found {
+			t.Errorf("Expected a problem with %s, Got: %q", expected, problems)
+		}
+	}
+	if len(problems) != 3 {
+		t.Errorf("Expected 3 problems, Got: %q", problems)
+	}
+	if _, ok := emailTemplates[filepath.Join(dir, "reminder.html")]; !ok {
+		t.Errorf("Expected the good template to be loaded")
+	}
+
+	// A template set with REMINDER_TEMPLATE_<N> is used without the layout, even in TEMPLATE_DIR
+	page := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(page, []byte(`<div>{{ .TimeLeft }} left</div>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	envy.Temp(func() {
+		envy.Set("REMINDER_TEMPLATE_0", page)
+		if policy, err = newReminderPolicy("", "7,3,1,0", ""); err != nil {
+			t.Fatal(err)
+		}
+	})
+	emailTemplates = map[string]*template.Template{}
+	if problems := loadEmailTemplates(allHubs()); len(problems) != 3 {
+		t.Errorf("Expected 3 problems, Got: %q", problems)
+	}
+	r, _ = policy.Reminder(0)
+	values, _ = envHub().emailData(sampleEntry(r), r)
+	buf.Reset()
+	if err := emailTemplates[page].Execute(&buf, values); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<p>") {
+		t.Errorf("Expected the page without the layout, Got: %s", buf.String())
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	day := time.Date(2024, time.May, 8, 0, 0, 0, 0, sheetdata.DefaultLocation())
+	if got := formatDate(day); got != "8 May 2024" {
+		t.Errorf("Expected: 8 May 2024, Got: %s\n", got)
+	}
+	if got := formatDate(day, "Mon 2 Jan"); got != "Wed 8 May" {
+		t.Errorf("Expected: Wed 8 May, Got: %s\n", got)
+	}
+}
@@ -0,0 +1,164 @@
+package ledger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a reminder that could not be sent, even after retrying
+type DeadLetter struct {
+	Key
+	Error    string
+	FailedAt time.Time
+	// Attempts counts the runs that failed to send the reminder
+	Attempts int
+	// FirstFailedAt is when the first of those runs failed
+	FirstFailedAt time.Time
+}
+
+// Since returns when the reminder first failed. Dead letters saved before that was recorded use FailedAt.
+func (d DeadLetter) Since() time.Time {
+	if d.FirstFailedAt.IsZero() {
+		return d.FailedAt
+	}
+	return d.FirstFailedAt
+}
+
+// DeadLetters keeps the reminders that could not be sent, so that the next run can retry them first
+type DeadLetters interface {
+	// List returns the dead letters, oldest first
+	List() ([]DeadLetter, error)
+	// Add saves a dead letter, replacing any with the same key
+	Add(letter DeadLetter) error
+	// Remove deletes the dead letter with the given key, if there is one
+	Remove(key Key) error
+}
+
+// deadLetterList is a list of dead letters with at most one per key
+type deadLetterList []DeadLetter
+
+func (l deadLetterList) add(letter DeadLetter) deadLetterList {
+	return append(l.remove(letter.Key), letter)
+}
+
+func (l deadLetterList) remove(key Key) deadLetterList {
+	kept := l[:0:0]
+	for _, letter := range l {
+		if letter.Key.String() != key.String() {
+			kept = append(kept, letter)
+		}
+	}
+	return kept
+}
+
+// MemoryDeadLetters keeps dead letters in memory. It is meant for tests and one-off runs.
+type MemoryDeadLetters struct {
+	mu      sync.Mutex
+	letters deadLetterList
+}
+
+// List returns a copy of the dead letters
+func (m *MemoryDeadLetters) List() ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]DeadLetter{}, m.letters...), nil
+}
+
+// Add saves a dead letter in memory
+func (m *MemoryDeadLetters) Add(letter DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = m.letters.add(letter)
+	return nil
+}
+
+// Remove deletes a dead letter from memory
+func (m *MemoryDeadLetters) Remove(key Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = m.letters.remove(key)
+	return nil
+}
+
+// FileDeadLetters keeps dead letters in a JSON file, which is replaced whole on every change.
+// A missing file holds no dead letters.
+type FileDeadLetters struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// List reads the dead letters from the file
+func (f *FileDeadLetters) List() ([]DeadLetter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read()
+}
+
+// Add saves a dead letter to the file
+func (f *FileDeadLetters) Add(letter DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	letters, err := f.read()
+	if err != nil {
+		return err
+	}
+	return f.write(letters.add(letter))
+}
+
+// Remove deletes a dead letter from the file
+func (f *FileDeadLetters) Remove(key Key) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	letters, err := f.read()
+	if err != nil {
+		return err
+	}
+	return f.write(letters.remove(key))
+}
+
+func (f *FileDeadLetters) read() (deadLetterList, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to read dead letter file "+f.Path)
+	}
+	var letters deadLetterList
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, errors.Wrap(err, "Corrupt dead letter file "+f.Path)
+	}
+	return letters, nil
+}
+
+// write replaces the file through a temporary file, so a crash never leaves it half written
+func (f *FileDeadLetters) write(letters deadLetterList) error {
+	data, err := json.MarshalIndent(letters, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "Unable to encode dead letters")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return errors.WithMessage(err, "Unable to write dead letter file "+f.Path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "Unable to write dead letter file "+f.Path)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "Unable to sync dead letter file "+f.Path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithMessage(err, "Unable to write dead letter file "+f.Path)
+	}
+	return errors.WithMessage(os.Rename(tmp.Name(), f.Path), "Unable to replace dead letter file "+f.Path)
+}
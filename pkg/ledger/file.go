@@ -0,0 +1,75 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileStore is a Store backed by an append-only file with one JSON entry per line.
+// The file is read into memory when opened and every recorded entry is synced to disk before Record returns.
+type FileStore struct {
+	mu      sync.RWMutex
+	file    *os.File
+	entries map[string]Entry
+}
+
+// OpenFileStore opens the ledger file at path, creating it if it doesn't exist
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to open ledger file "+path)
+	}
+	store := &FileStore{file: f, entries: map[string]Entry{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "Corrupt entry on line %d of ledger file %s", line, path)
+		}
+		store.entries[entry.Key.String()] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, errors.WithMessage(err, "Unable to read ledger file "+path)
+	}
+	return store, nil
+}
+
+// Has reports whether a reminder with the given key has been recorded
+func (s *FileStore) Has(key Key) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.entries[key.String()]
+	return ok, nil
+}
+
+// Record appends an entry to the ledger file
+func (s *FileStore) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.WithMessage(err, "Unable to encode ledger entry")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return errors.WithMessage(err, "Unable to write ledger entry")
+	}
+	if err := s.file.Sync(); err != nil {
+		return errors.WithMessage(err, "Unable to sync ledger file")
+	}
+	s.entries[entry.Key.String()] = entry
+	return nil
+}
+
+// Close closes the ledger file
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,45 @@
+package ledger
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key identifies a reminder sent to a subscriber for one subscription period
+type Key struct {
+	// Kind sets apart records that aren't reminders to a subscriber, such as the staff digest, so they never
+	// match a reminder's key. Reminders have no kind.
+	Kind    string `json:",omitempty"`
+	Email   string
+	EndDate time.Time
+	Offset  int
+}
+
+// String returns the form of the key used by stores. Emails are compared case-insensitively
+// and only the calendar date of EndDate is significant.
+func (k Key) String() string {
+	s := strings.ToLower(strings.TrimSpace(k.Email)) + "|" + k.EndDate.Format("2006-01-02") + "|" + strconv.Itoa(k.Offset)
+	if k.Kind != "" {
+		return k.Kind + "|" + s
+	}
+	return s
+}
+
+// Entry records a successful send
+type Entry struct {
+	Key
+	SentAt time.Time
+	// MessageID is the mail provider's ID for the message, e.g. SendGrid's X-Message-Id, for tracing deliveries
+	MessageID string `json:",omitempty"`
+}
+
+// Store keeps track of the reminders that have been sent
+type Store interface {
+	// Has reports whether a reminder with the given key has been recorded
+	Has(key Key) (bool, error)
+	// Record saves an entry so that later calls to Has with its key return true
+	Record(entry Entry) error
+	// Close releases any resources held by the store
+	Close() error
+}
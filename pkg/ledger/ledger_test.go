@@ -0,0 +1,98 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reminders.ledger")
+	fileStore, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	stores := map[string]Store{"memory": NewMemoryStore(), "file": fileStore}
+	endDate := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sent := Key{Email: "ada@example.com", EndDate: endDate, Offset: 3}
+	digest := Key{Kind: "digest", EndDate: endDate}
+	for name, store := range stores {
+		for _, key := range []Key{sent, digest} {
+			if err := store.Record(Entry{Key: key, SentAt: time.Now()}); err != nil {
+				t.Fatalf("%s: Unexpected error: %+v", name, err)
+			}
+		}
+		testCases := map[string]struct {
+			Key      Key
+			Expected bool
+		}{
+			"Recorded key":            {Key: sent, Expected: true},
+			"Different case and time": {Key: Key{Email: " Ada@Example.com", EndDate: endDate.Add(time.Hour), Offset: 3}, Expected: true},
+			"Different offset":        {Key: Key{Email: sent.Email, EndDate: endDate, Offset: 1}, Expected: false},
+			"Renewed subscription":    {Key: Key{Email: sent.Email, EndDate: endDate.AddDate(0, 1, 0), Offset: 3}, Expected: false},
+			"Other kind of record":    {Key: Key{Kind: "digest", Email: sent.Email, EndDate: endDate, Offset: 3}, Expected: false},
+			"Recorded kind":           {Key: digest, Expected: true},
+		}
+		for testcase, data := range testCases {
+			got, err := store.Has(data.Key)
+			if err != nil || got != data.Expected {
+				t.Errorf("%s: %s\n\tExpected: %v, Got: %v (%v)\n", name, testcase, data.Expected, got, err)
+			}
+		}
+		if err := store.Close(); err != nil {
+			t.Errorf("%s: Unexpected error: %+v", name, err)
+		}
+	}
+	// Entries must survive reopening the file
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	defer reopened.Close()
+	for _, key := range []Key{sent, digest} {
+		if ok, _ := reopened.Has(key); !ok {
+			t.Errorf("Expected the reopened ledger to contain %s", key)
+		}
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead-letters.json")
+	stores := map[string]DeadLetters{"memory": &MemoryDeadLetters{}, "file": &FileDeadLetters{Path: path}}
+	endDate := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ada := Key{Email: "ada@example.com", EndDate: endDate, Offset: 3}
+	bola := Key{Email: "bola@example.com", EndDate: endDate, Offset: 1}
+	for name, store := range stores {
+		if letters, err := store.List(); err != nil || len(letters) != 0 {
+			t.Fatalf("%s: Expected no dead letters, Got: %+v (%v)", name, letters, err)
+		}
+		for _, letter := range []DeadLetter{{Key: ada, Error: "503"}, {Key: bola, Error: "429"}, {Key: ada, Error: "500"}} {
+			if err := store.Add(letter); err != nil {
+				t.Fatalf("%s: Unexpected error: %+v", name, err)
+			}
+		}
+		// Adding a key again replaces its dead letter
+		letters, err := store.List()
+		if err != nil || len(letters) != 2 || letters[0].Key != bola || letters[1].Error != "500" {
+			t.Errorf("%s: Unexpected dead letters %+v (%v)", name, letters, err)
+		}
+		if err := store.Remove(Key{Email: "ADA@example.com", EndDate: endDate, Offset: 3}); err != nil {
+			t.Fatalf("%s: Unexpected error: %+v", name, err)
+		}
+		if letters, err := store.List(); err != nil || len(letters) != 1 || letters[0].Key != bola {
+			t.Errorf("%s: Expected only %s, Got: %+v (%v)", name, bola, letters, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ledger
+
+import "sync"
+
+// MemoryStore is a Store that keeps entries in memory. It is meant for tests and one-off runs.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]Entry{}}
+}
+
+// Has reports whether a reminder with the given key has been recorded
+func (m *MemoryStore) Has(key Key) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.entries[key.String()]
+	return ok, nil
+}
+
+// Record saves an entry in memory
+func (m *MemoryStore) Record(entry Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entry.Key.String()] = entry
+	return nil
+}
+
+// Close does nothing for a MemoryStore
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,217 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/pkg/errors"
+)
+
+// Kinds of issue found in the sheet
+const (
+	MissingEmail   = "missing_email"
+	MalformedEmail = "malformed_email"
+	DuplicateEmail = "duplicate_email"
+	SuspectEmail   = "suspect_email"
+	MissingDate    = "missing_end_date"
+	BadDate        = "unparseable_end_date"
+	FarPastDate    = "end_date_far_past"
+	FarFutureDate  = "end_date_far_future"
+	BlankName      = "blank_name"
+	ExtraData      = "extra_data"
+	Unreadable     = "unreadable_cell"
+	UnknownPlan    = "unknown_plan"
+)
+
+// Default limits on how far from today an end date may be before it is reported
+const (
+	DefaultMaxPastDays   = 365
+	DefaultMaxFutureDays = 400
+)
+
+// Options configures the checks
+type Options struct {
+	// Parser reads the rows of the sheet. Its Clock tells what "today" is.
+	Parser sheetdata.Options
+	// FirstRow is the sheet row number of the header row
+	FirstRow int
+	// MaxPastDays and MaxFutureDays are how many days before or after today an end date may be.
+	// Zero means the default.
+	MaxPastDays   int
+	MaxFutureDays int
+	// Plans are the names of the plans with their own reminder schedule. If there are any, a plan cell naming
+	// another plan is reported, since that subscriber gets the default schedule.
+	Plans []string
+}
+
+// Issue is a problem with one cell or row of the sheet
+type Issue struct {
+	Row int `json:"row"`
+	// Cell is the A1 address of the offending cell, if the issue is with a single cell
+	Cell    string `json:"cell,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Report lists the issues found in the sheet, in row order
+type Report struct {
+	RowsRead int     `json:"rows_read"`
+	Issues   []Issue `json:"issues"`
+}
+
+// Sheet checks every row of a sheet whose first row holds the column headers. A missing required header
+// is returned as an error, since no row can be read without it.
+func Sheet(values [][]interface{}, opts Options) (*Report, error) {
+	if len(values) == 0 {
+		return nil, errors.New("Missing sheets data")
+	}
+	if opts.MaxPastDays == 0 {
+		opts.MaxPastDays = DefaultMaxPastDays
+	}
+	if opts.MaxFutureDays == 0 {
+		opts.MaxFutureDays = DefaultMaxFutureDays
+	}
+	if opts.Parser.Clock == nil {
+		opts.Parser.Clock = sheetdata.SystemClock
+	}
+	if len(opts.Parser.DateLayouts) == 0 {
+		opts.Parser.DateLayouts = sheetdata.DefaultDateLayouts
+	}
+	if opts.Parser.Location == nil {
+		opts.Parser.Location = sheetdata.DefaultLocation()
+	}
+	parser, err := sheetdata.NewParser(values[0], opts.Parser)
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{
+		parser: parser,
+		opts:   opts,
+		header: values[0],
+		report: &Report{Issues: []Issue{}},
+		emails: map[string]int{},
+	}
+	for i, row := range values[1:] {
+		l.row(opts.FirstRow+i+1, row)
+	}
+	return l.report, nil
+}
+
+// linter holds the state of a check through the rows
+type linter struct {
+	parser *sheetdata.Parser
+	opts   Options
+	header []interface{}
+	report *Report
+	// Row each email address was first seen on
+	emails map[string]int
+}
+
+func (l *linter) row(num int, data []interface{}) {
+	if _, err := l.parser.NewSheetEntry(num, data); err == sheetdata.ErrBlankRow {
+		return
+	}
+	l.report.RowsRead++
+	if firstName, ok := l.text(num, data, sheetdata.FieldFirstName); ok && firstName == "" {
+		l.add(num, sheetdata.FieldFirstName, BlankName, "First name is blank")
+	}
+	l.text(num, data, sheetdata.FieldLastName)
+	l.email(num, data)
+	l.endDate(num, data)
+	l.plan(num, data)
+	for i, value := range data {
+		if i < len(l.header) && strings.TrimSpace(fmt.Sprint(l.header[i])) != "" {
+			continue
+		}
+		if text, err := sheetdata.CellText(value); err != nil || text != "" {
+			l.report.Issues = append(l.report.Issues, Issue{
+				Row:     num,
+				Cell:    l.cellName(num, i),
+				Kind:    ExtraData,
+				Message: fmt.Sprintf("Value %v is in a column without a header", value),
+			})
+		}
+	}
+}
+
+func (l *linter) email(num int, data []interface{}) {
+	cell, ok := l.text(num, data, sheetdata.FieldEmail)
+	if !ok {
+		return
+	}
+	if cell == "" {
+		l.add(num, sheetdata.FieldEmail, MissingEmail, "Email is empty")
+		return
+	}
+	emails, err := sheetdata.ParseEmails(cell)
+	if err != nil {
+		l.add(num, sheetdata.FieldEmail, MalformedEmail, err.Error())
+		return
+	}
+	for _, email := range emails {
+		if suggestion := sheetdata.SuggestEmail(email); suggestion != "" {
+			l.add(num, sheetdata.FieldEmail, SuspectEmail, fmt.Sprintf("%s may be a typo, did you mean %s?", email, suggestion))
+		}
+		if first, seen := l.emails[email]; seen {
+			l.add(num, sheetdata.FieldEmail, DuplicateEmail, fmt.Sprintf("%s is also on row %d", email, first))
+			continue
+		}
+		l.emails[email] = num
+	}
+}
+
+func (l *linter) plan(num int, data []interface{}) {
+	cell, ok := l.text(num, data, sheetdata.FieldPlan)
+	if !ok || cell == "" || len(l.opts.Plans) == 0 {
+		return
+	}
+	plan := sheetdata.NormalisePlan(cell)
+	for _, known := range l.opts.Plans {
+		if plan == sheetdata.NormalisePlan(known) {
+			return
+		}
+	}
+	l.add(num, sheetdata.FieldPlan, UnknownPlan, fmt.Sprintf("Plan %q is not one of %s, so it gets the default reminders",
+		cell, strings.Join(l.opts.Plans, ", ")))
+}
+
+func (l *linter) endDate(num int, data []interface{}) {
+	value := l.parser.Cell(data, sheetdata.FieldEndDate)
+	if text, err := sheetdata.CellText(value); err == nil && text == "" {
+		l.add(num, sheetdata.FieldEndDate, MissingDate, "End date is empty")
+		return
+	}
+	endDate, err := sheetdata.TimeFromSheet(value, l.opts.Parser.DateLayouts, l.opts.Parser.Location)
+	if err != nil {
+		l.add(num, sheetdata.FieldEndDate, BadDate, err.Error())
+		return
+	}
+	daysLeft := sheetdata.SheetEntry{EndDate: endDate}.DaysLeftAt(l.opts.Parser.Clock.Now())
+	switch {
+	case daysLeft < -l.opts.MaxPastDays:
+		l.add(num, sheetdata.FieldEndDate, FarPastDate, fmt.Sprintf("%s is %d days ago", endDate.Format("2 Jan 2006"), -daysLeft))
+	case daysLeft > l.opts.MaxFutureDays:
+		l.add(num, sheetdata.FieldEndDate, FarFutureDate, fmt.Sprintf("%s is %d days away", endDate.Format("2 Jan 2006"), daysLeft))
+	}
+}
+
+// text reads field as text, reporting cells that hold something other than text, numbers or booleans
+func (l *linter) text(num int, data []interface{}, field string) (string, bool) {
+	text, err := sheetdata.CellText(l.parser.Cell(data, field))
+	if err != nil {
+		l.add(num, field, Unreadable, err.Error())
+		return "", false
+	}
+	return text, true
+}
+
+// add reports an issue with the cell of field in the given row
+func (l *linter) add(num int, field, kind, message string) {
+	column, _ := l.parser.Column(field)
+	l.report.Issues = append(l.report.Issues, Issue{Row: num, Cell: l.cellName(num, column), Kind: kind, Message: message})
+}
+
+func (l *linter) cellName(num, column int) string {
+	return sheetdata.CellName(num, l.opts.Parser.FirstColumn+column)
+}
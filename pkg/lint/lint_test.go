@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+)
+
+func TestSheet(t *testing.T) {
+	clock := sheetdata.FixedClock(time.Date(2024, time.May, 1, 9, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Last Name", "Email", "End Date", "", "Notes"},
+		{"Ada", "Obi", "ada@example.com", "01/06/24"},
+		{"", "Ade", "bola@gmail,com", "soon"},
+		{"Chidi", "Eze", "chidi@example.com; ADA@example.com", "01/06/14"},
+		{},
+		{"Dayo", "Ola", "", "01/06/34", "paid cash", "VIP"},
+		{"Emeka", "Nwosu", "emeka@example.com"},
+	}
+	report, err := Sheet(values, Options{Parser: sheetdata.Options{Clock: clock}, FirstRow: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := []struct {
+		Row        int
+		Cell, Kind string
+	}{
+		{3, "A3", BlankName},
+		{3, "C3", MalformedEmail},
+		{3, "D3", BadDate},
+		{4, "C4", DuplicateEmail},
+		{4, "D4", FarPastDate},
+		{6, "C6", MissingEmail},
+		{6, "D6", FarFutureDate},
+		{6, "E6", ExtraData},
+		{7, "D7", MissingDate},
+	}
+	if report.RowsRead != 5 || len(report.Issues) != len(expected) {
+		t.Fatalf("Expected 5 rows and %d issues, Got: %d %+v", len(expected), report.RowsRead, report.Issues)
+	}
+	for i, e := range expected {
+		got := report.Issues[i]
+		if got.Row != e.Row || got.Cell != e.Cell || got.Kind != e.Kind || got.Message == "" {
+			t.Errorf("Issue %d\n\tExpected: %+v, Got: %+v\n", i, e, got)
+		}
+	}
+}
+
+func TestSheetSuggestsEmail(t *testing.T) {
+	clock := sheetdata.FixedClock(time.Date(2024, time.May, 1, 9, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{{"First Name", "Email", "End Date"}, {"Bola", "bola@gmial.com", "01/06/24"}}
+	report, err := Sheet(values, Options{Parser: sheetdata.Options{Clock: clock}, FirstRow: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != SuspectEmail || !strings.Contains(report.Issues[0].Message, "did you mean bola@gmail.com?") {
+		t.Errorf("Expected a suggestion of bola@gmail.com, Got: %+v", report.Issues)
+	}
+}
+
+func TestSheetUnknownPlan(t *testing.T) {
+	clock := sheetdata.FixedClock(time.Date(2024, time.May, 1, 9, 0, 0, 0, sheetdata.DefaultLocation()))
+	values := [][]interface{}{
+		{"First Name", "Email", "End Date", "Plan"},
+		{"Ada", "ada@example.com", "01/06/24", "Weekly"},
+		{"Bola", "bola@example.com", "01/06/24", "Montly"},
+		{"Chidi", "chidi@example.com", "01/06/24"},
+	}
+	report, err := Sheet(values, Options{Parser: sheetdata.Options{Clock: clock}, FirstRow: 1, Plans: []string{"weekly", "monthly"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Cell != "D3" || report.Issues[0].Kind != UnknownPlan {
+		t.Errorf("Expected an unknown plan in D3, Got: %+v", report.Issues)
+	}
+}
+
+func TestSheetMissingHeader(t *testing.T) {
+	report, err := Sheet([][]interface{}{{"First Name", "End Date"}}, Options{})
+	if err == nil || report != nil {
+		t.Errorf("Expected an error for the missing Email header, Got: %+v", report)
+	}
+}
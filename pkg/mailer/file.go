@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File writes each message to an .eml file in a directory instead of sending it.
+// It is meant for local runs and for checking what would have been sent.
+type File struct {
+	dir   string
+	count uint64
+}
+
+// NewFile creates a File mailer writing to dir, creating the directory if needed
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithMessage(err, "Unable to create mail directory "+dir)
+	}
+	return &File{dir: dir}, nil
+}
+
+// Send writes msg to a new file named after the time and the recipient, and returns its Message-ID
+func (f *File) Send(msg Message) (string, error) {
+	id := messageID(msg.FromEmail)
+	body, err := msg.encode(id)
+	if err != nil {
+		return "", errors.WithMessage(err, "Cannot encode message.")
+	}
+	n := atomic.AddUint64(&f.count, 1)
+	name := fmt.Sprintf("%s-%d-%s.eml", time.Now().UTC().Format("20060102T150405"), n, fileSafe(msg.ToEmail))
+	if err := ioutil.WriteFile(filepath.Join(f.dir, name), body, 0644); err != nil {
+		return "", errors.WithMessage(err, "Unable to write message file.")
+	}
+	return id, nil
+}
+
+// fileSafe replaces characters that are awkward in file names
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email ready to be sent
+type Message struct {
+	FromName  string
+	FromEmail string
+	// ReplyTo is the address replies should go to, if not the sender's
+	ReplyTo string
+	ToName  string
+	ToEmail string
+	// Cc are more addresses of the recipient, e.g. a personal and a work address
+	Cc      []string
+	Subject string
+	// Text and HTML are the plain text and HTML versions of the body
+	Text string
+	HTML string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	// Send sends msg and returns the ID the provider gave it, which may be empty
+	Send(msg Message) (string, error)
+}
+
+// From returns the formatted sender address
+func (m Message) From() string {
+	return (&mail.Address{Name: m.FromName, Address: m.FromEmail}).String()
+}
+
+// To returns the formatted recipient address
+func (m Message) To() string {
+	return (&mail.Address{Name: m.ToName, Address: m.ToEmail}).String()
+}
+
+// Recipients returns every address the message is sent to
+func (m Message) Recipients() []string {
+	return append([]string{m.ToEmail}, m.Cc...)
+}
+
+// Bytes encodes the message in RFC 5322 format with a multipart/alternative body
+func (m Message) Bytes() ([]byte, error) {
+	return m.encode(messageID(m.FromEmail))
+}
+
+// encode encodes the message like Bytes with the given Message-ID header
+func (m Message) encode(id string) ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+	headers := []struct{ name, value string }{
+		{"From", m.From()},
+		{"To", m.To()},
+		{"Cc", strings.Join(m.Cc, ", ")},
+		{"Reply-To", m.ReplyTo},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", id},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + body.Boundary()},
+	}
+	var header bytes.Buffer
+	for _, h := range headers {
+		if h.value != "" {
+			fmt.Fprintf(&header, "%s: %s\r\n", h.name, h.value)
+		}
+	}
+	header.WriteString("\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return append(header.Bytes(), buf.Bytes()...), nil
+}
+
+// messageID generates a unique Message-ID header value for a sender
+func messageID(fromEmail string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if at := strings.LastIndex(fromEmail, "@"); at >= 0 {
+		domain = fromEmail[at+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,200 @@
+package mailer
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var testMessage = Message{
+	FromName:  "SprintHub",
+	FromEmail: "noreply@sprinthub.com.ng",
+	ToName:    "Ada",
+	ToEmail:   "ada@example.com",
+	Subject:   "Co-working Space Subscription Expiry",
+	Text:      "Your subscription will expire in 3 days.",
+	HTML:      "<p>Your subscription will expire in 3 days.</p>",
+}
+
+// fakeSMTPServer accepts one SMTP session and sends the received envelope and data on the returned channel
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var session strings.Builder
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				session.WriteString(line)
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					session.WriteString(data)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				received <- session.String()
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTPSend(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	m, err := NewSMTP(addr, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	msg := testMessage
+	msg.Cc = []string{"ada@work.example.com"}
+	msg.ReplyTo = "lekki@sprinthub.com.ng"
+	id, err := m.Send(msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	session := <-received
+	for _, expected := range []string{
+		"Message-ID: " + id,
+		"MAIL FROM:<noreply@sprinthub.com.ng>",
+		"RCPT TO:<ada@example.com>",
+		"RCPT TO:<ada@work.example.com>",
+		"Cc: ada@work.example.com",
+		"Reply-To: lekki@sprinthub.com.ng",
+		"To: \"Ada\" <ada@example.com>",
+		"Subject: Co-working Space Subscription Expiry",
+		"Content-Type: text/html; charset=utf-8",
+		"<p>Your subscription will expire in 3 days.</p>",
+	} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("Expected the SMTP session to contain %q\n%s", expected, session)
+		}
+	}
+}
+
+func TestFileSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := NewFile(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.Send(testMessage); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "out", "*-ada@example.com.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 message files, Got: %v (%v)", files, err)
+	}
+	body, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "Your subscription will expire in 3 days.") {
+		t.Errorf("Expected the message file to contain the text body\n%s", body)
+	}
+}
+
+func TestSendGridSend(t *testing.T) {
+	testCases := map[string]struct {
+		Status        int
+		Body          string
+		ExpectedID    string
+		ExpectedError string
+	}{
+		"Accepted": {Status: http.StatusAccepted, ExpectedID: "msg-1"},
+		"Bad request": {
+			Status:        http.StatusBadRequest,
+			Body:          `{"errors": [{"message": "Does not contain a valid address.", "field": "from.email"}]}`,
+			ExpectedError: "SendGrid responded with 400 Bad Request: from.email: Does not contain a valid address.",
+		},
+		"Unauthorized": {
+			Status:        http.StatusUnauthorized,
+			Body:          `{"errors": [{"message": "The provided authorization grant is invalid, expired, or revoked"}]}`,
+			ExpectedError: "SendGrid responded with 401 Unauthorized: The provided authorization grant is invalid, expired, or revoked",
+		},
+	}
+	for testcase, data := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if data.ExpectedID != "" {
+				w.Header().Set("X-Message-Id", data.ExpectedID)
+			}
+			w.WriteHeader(data.Status)
+			w.Write([]byte(data.Body))
+		}))
+		m := NewSendGrid("key", true)
+		m.client.BaseURL = server.URL + "/v3/mail/send"
+		id, err := m.Send(testMessage)
+		server.Close()
+		if data.ExpectedError == "" {
+			if err != nil || id != data.ExpectedID {
+				t.Errorf("%s\n\tExpected: %v, Got: %v (%v)\n", testcase, data.ExpectedID, id, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != data.ExpectedError || !Rejected(err) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.ExpectedError, err)
+		}
+	}
+}
+
+func TestRejected(t *testing.T) {
+	testCases := map[string]struct {
+		Err      error
+		Expected bool
+	}{
+		"SendGrid 400":       {Err: &ResponseError{Code: 400}, Expected: true},
+		"SendGrid 429":       {Err: &ResponseError{Code: 429}, Expected: false},
+		"SendGrid 503":       {Err: &ResponseError{Code: 503}, Expected: false},
+		"SMTP 550":           {Err: errors.WithMessage(&textproto.Error{Code: 550, Msg: "No such user"}, "Message sending failed."), Expected: true},
+		"SMTP 421":           {Err: &textproto.Error{Code: 421, Msg: "Try again later"}, Expected: false},
+		"Connection refused": {Err: errors.New("dial tcp: connection refused"), Expected: false},
+	}
+	for testcase, data := range testCases {
+		if got := Rejected(data.Err); got != data.Expected {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/pkg/errors"
+	sendgrid "github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGrid sends messages through the SendGrid v3 API
+type SendGrid struct {
+	client  *sendgrid.Client
+	sandbox bool
+}
+
+// NewSendGrid creates a SendGrid mailer. In sandbox mode SendGrid validates messages without delivering them.
+func NewSendGrid(apiKey string, sandbox bool) *SendGrid {
+	return &SendGrid{client: sendgrid.NewSendClient(apiKey), sandbox: sandbox}
+}
+
+// ResponseError is a SendGrid response that says the message was not accepted
+type ResponseError struct {
+	Code    int
+	Headers http.Header
+	// Body is the response body, which explains what was wrong with the request
+	Body string
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("SendGrid responded with %d %s", e.Code, http.StatusText(e.Code))
+	if reasons := e.Reasons(); len(reasons) > 0 {
+		return msg + ": " + strings.Join(reasons, "; ")
+	}
+	if body := strings.TrimSpace(e.Body); body != "" {
+		return msg + ": " + body
+	}
+	return msg
+}
+
+// Reasons returns the error messages in the response body, e.g. "The from email does not contain a valid address."
+func (e *ResponseError) Reasons() []string {
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal([]byte(e.Body), &body) != nil {
+		return nil
+	}
+	reasons := make([]string, 0, len(body.Errors))
+	for _, item := range body.Errors {
+		if item.Field != "" {
+			reasons = append(reasons, item.Field+": "+item.Message)
+		} else {
+			reasons = append(reasons, item.Message)
+		}
+	}
+	return reasons
+}
+
+// StatusCode returns the HTTP status of the response
+func (e *ResponseError) StatusCode() int {
+	return e.Code
+}
+
+// Header returns the headers of the response, which may include Retry-After
+func (e *ResponseError) Header() http.Header {
+	return e.Headers
+}
+
+// Send sends msg through SendGrid and returns the X-Message-Id SendGrid gave it.
+// A response other than 2xx is returned as a *ResponseError.
+func (s *SendGrid) Send(msg Message) (string, error) {
+	from := mail.NewEmail(msg.FromName, msg.FromEmail)
+	to := mail.NewEmail(msg.ToName, msg.ToEmail)
+	message := mail.NewSingleEmail(from, msg.Subject, to, msg.Text, msg.HTML)
+	for _, cc := range msg.Cc {
+		message.Personalizations[0].AddCCs(mail.NewEmail(msg.ToName, cc))
+	}
+	if msg.ReplyTo != "" {
+		message.SetReplyTo(mail.NewEmail("", msg.ReplyTo))
+	}
+	message.SetMailSettings(&mail.MailSettings{
+		SandboxMode: &mail.Setting{
+			Enable: &s.sandbox,
+		},
+	})
+	resp, err := s.client.Send(message)
+	if err != nil {
+		return "", errors.WithMessage(err, "Message sending failed.")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &ResponseError{Code: resp.StatusCode, Headers: resp.Headers, Body: resp.Body}
+	}
+	return http.Header(resp.Headers).Get("X-Message-Id"), nil
+}
+
+// Rejected reports whether err means the mail provider refused the message, so that sending it again won't help.
+// These are SendGrid 4xx responses other than 429, and permanent (5xx) SMTP replies.
+func Rejected(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *ResponseError:
+		return e.Code >= 400 && e.Code < 500 && e.Code != http.StatusTooManyRequests
+	case *textproto.Error:
+		return e.Code >= 500
+	}
+	return false
+}
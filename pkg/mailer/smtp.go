@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+
+	"github.com/pkg/errors"
+)
+
+// SMTP sends messages through an SMTP server
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTP creates an SMTP mailer for the server at addr (host:port). If username is empty no authentication is used.
+func NewSMTP(addr, username, password string) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid SMTP address %q", addr)
+	}
+	s := &SMTP{addr: addr}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s, nil
+}
+
+// Send sends msg through the SMTP server and returns its Message-ID
+func (s *SMTP) Send(msg Message) (string, error) {
+	id := messageID(msg.FromEmail)
+	body, err := msg.encode(id)
+	if err != nil {
+		return "", errors.WithMessage(err, "Cannot encode message.")
+	}
+	if err := smtp.SendMail(s.addr, s.auth, msg.FromEmail, msg.Recipients(), body); err != nil {
+		return "", errors.WithMessage(err, "Message sending failed.")
+	}
+	return id, nil
+}
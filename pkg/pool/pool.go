@@ -0,0 +1,74 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pool runs jobs on a bounded number of workers, starting at most a given number of jobs per second
+type Pool struct {
+	workers  int
+	interval time.Duration
+}
+
+// New creates a Pool with the given number of workers that starts at most perSecond jobs a second.
+// A perSecond of zero or less means no rate limit.
+func New(workers int, perSecond float64) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{workers: workers}
+	if perSecond > 0 {
+		p.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return p
+}
+
+// Run calls job for each index from 0 to n-1 and waits for the started jobs to finish.
+// Once ctx is done no more jobs are started; jobs already running are left to finish.
+// It returns the indexes of the jobs that were never started.
+func (p *Pool) Run(ctx context.Context, n int, job func(i int)) []int {
+	var tick <-chan time.Time
+	if p.interval > 0 {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < p.workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				job(i)
+			}
+		}()
+	}
+	var dropped []int
+	for i := 0; i < n; i++ {
+		// Wait for the rate limit before handing out the job, unless it is the first one
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case <-ctx.Done():
+		default:
+			select {
+			case queue <- i:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		for ; i < n; i++ {
+			dropped = append(dropped, i)
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return dropped
+}
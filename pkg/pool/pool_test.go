@@ -0,0 +1,74 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunConcurrency(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		maxSeen int
+		done    = make([]bool, 20)
+	)
+	dropped := New(3, 0).Run(context.Background(), len(done), func(i int) {
+		mu.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		done[i] = true
+		mu.Unlock()
+	})
+	if len(dropped) != 0 {
+		t.Errorf("Expected no dropped jobs, Got: %v", dropped)
+	}
+	if maxSeen > 3 {
+		t.Errorf("Expected at most 3 jobs at once, Got: %d", maxSeen)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("Job %d did not run", i)
+		}
+	}
+}
+
+func TestRunRateLimit(t *testing.T) {
+	start := time.Now()
+	New(10, 50).Run(context.Background(), 6, func(i int) {})
+	// 6 jobs at 50 a second need at least 5 intervals of 20ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the jobs to take at least 100ms, Got: %v", elapsed)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu       sync.Mutex
+		finished []int
+	)
+	dropped := New(2, 0).Run(ctx, 10, func(i int) {
+		if i == 1 {
+			cancel()
+		}
+		// Jobs in flight finish even though the context is done
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		finished = append(finished, i)
+		mu.Unlock()
+	})
+	if len(finished)+len(dropped) != 10 {
+		t.Errorf("Expected every job to either finish or be dropped, Got: %v finished, %v dropped", finished, dropped)
+	}
+	if len(dropped) < 7 {
+		t.Errorf("Expected queued jobs to be dropped after cancel, Got: %v finished, %v dropped", finished, dropped)
+	}
+}
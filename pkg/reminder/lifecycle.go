@@ -0,0 +1,91 @@
+package reminder
+
+import (
+	"github.com/pkg/errors"
+)
+
+// State is where a subscription is in its lifecycle
+type State string
+
+// States of a subscription, in the order it goes through them
+const (
+	// Active subscriptions have more than ExpiringDays left
+	Active State = "active"
+	// Expiring subscriptions end within ExpiringDays, including on the end date itself
+	Expiring State = "expiring"
+	// Grace subscriptions have ended but are within the grace period
+	Grace State = "grace"
+	// Lapsed subscriptions are past the grace period
+	Lapsed State = "lapsed"
+	// Churned subscriptions ended ChurnDays or more ago
+	Churned State = "churned"
+)
+
+// Stages of the emails sent on lifecycle transitions
+const (
+	// StageExpired is sent the day after the end date, when the subscription leaves Expiring
+	StageExpired = "expired"
+	// StageGraceEnding is sent GraceWarningDays before the grace period ends
+	StageGraceEnding = "grace_ending"
+	// StageWinBack is sent when the subscription becomes Churned
+	StageWinBack = "win_back"
+)
+
+// Defaults of the lifecycle
+const (
+	DefaultExpiringDays = 7
+	DefaultGraceDays    = 7
+	DefaultChurnDays    = 30
+	// GraceWarningDays is how many days before the end of the grace period the warning is sent
+	GraceWarningDays = 2
+)
+
+// DefaultLifecycle is used when no lifecycle is configured
+var DefaultLifecycle = Lifecycle{ExpiringDays: DefaultExpiringDays, GraceDays: DefaultGraceDays, ChurnDays: DefaultChurnDays}
+
+// Lifecycle moves a subscription through its states by the days left on it:
+// Active, then Expiring for the last ExpiringDays days up to the end date, Grace for GraceDays days after it,
+// then Lapsed until ChurnDays after it and Churned from then on.
+type Lifecycle struct {
+	ExpiringDays int
+	GraceDays    int
+	ChurnDays    int
+}
+
+// Validate checks that the states follow each other
+func (l Lifecycle) Validate() error {
+	switch {
+	case l.ExpiringDays < 0:
+		return errors.Errorf("Expiring days must not be negative, got %d", l.ExpiringDays)
+	case l.GraceDays < 0:
+		return errors.Errorf("Grace days must not be negative, got %d", l.GraceDays)
+	case l.ChurnDays <= l.GraceDays:
+		return errors.Errorf("Churn days (%d) must be more than grace days (%d)", l.ChurnDays, l.GraceDays)
+	}
+	return nil
+}
+
+// State returns the state of a subscription with daysLeft days to expiry
+func (l Lifecycle) State(daysLeft int) State {
+	switch {
+	case daysLeft > l.ExpiringDays:
+		return Active
+	case daysLeft >= 0:
+		return Expiring
+	case daysLeft >= -l.GraceDays:
+		return Grace
+	case daysLeft > -l.ChurnDays:
+		return Lapsed
+	}
+	return Churned
+}
+
+// Reminders returns the emails sent on the transitions of the lifecycle. They have no subject or template.
+// The grace period warning is left out if the grace period is too short for it to come after the expiry email.
+func (l Lifecycle) Reminders() []Reminder {
+	reminders := []Reminder{{Offset: -1, Stage: StageExpired}}
+	if warning := -(l.GraceDays - GraceWarningDays); warning < -1 {
+		reminders = append(reminders, Reminder{Offset: warning, Stage: StageGraceEnding})
+	}
+	return append(reminders, Reminder{Offset: -l.ChurnDays, Stage: StageWinBack})
+}
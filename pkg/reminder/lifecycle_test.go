@@ -0,0 +1,68 @@
+package reminder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLifecycleState(t *testing.T) {
+	testCases := map[string]struct {
+		Value    int
+		Expected State
+	}{
+		"More than a week left":    {Value: 8, Expected: Active},
+		"A week left":              {Value: 7, Expected: Expiring},
+		"End date":                 {Value: 0, Expected: Expiring},
+		"Day after end date":       {Value: -1, Expected: Grace},
+		"Last day of grace":        {Value: -7, Expected: Grace},
+		"Day after grace":          {Value: -8, Expected: Lapsed},
+		"Day before churning":      {Value: -29, Expected: Lapsed},
+		"Thirty days after expiry": {Value: -30, Expected: Churned},
+		"Long gone":                {Value: -400, Expected: Churned},
+	}
+	for testcase, data := range testCases {
+		if got := DefaultLifecycle.State(data.Value); got != data.Expected {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestLifecycleReminders(t *testing.T) {
+	testCases := map[string]struct {
+		Value    Lifecycle
+		Expected []Reminder
+	}{
+		"Default": {Value: DefaultLifecycle, Expected: []Reminder{
+			{Offset: -1, Stage: StageExpired}, {Offset: -5, Stage: StageGraceEnding}, {Offset: -30, Stage: StageWinBack},
+		}},
+		"Short grace period has no warning": {Value: Lifecycle{GraceDays: 3, ChurnDays: 14}, Expected: []Reminder{
+			{Offset: -1, Stage: StageExpired}, {Offset: -14, Stage: StageWinBack},
+		}},
+		"No grace period": {Value: Lifecycle{ChurnDays: 30}, Expected: []Reminder{
+			{Offset: -1, Stage: StageExpired}, {Offset: -30, Stage: StageWinBack},
+		}},
+	}
+	for testcase, data := range testCases {
+		if got := data.Value.Reminders(); !reflect.DeepEqual(got, data.Expected) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestLifecycleValidate(t *testing.T) {
+	testCases := map[string]struct {
+		Value       Lifecycle
+		ExpectError bool
+	}{
+		"Default":                       {Value: DefaultLifecycle},
+		"No grace period":               {Value: Lifecycle{ExpiringDays: 7, ChurnDays: 30}},
+		"Negative grace period":         {Value: Lifecycle{ExpiringDays: 7, GraceDays: -1, ChurnDays: 30}, ExpectError: true},
+		"Churning before grace is over": {Value: Lifecycle{ExpiringDays: 7, GraceDays: 14, ChurnDays: 14}, ExpectError: true},
+		"Negative expiring days":        {Value: Lifecycle{ExpiringDays: -1, GraceDays: 7, ChurnDays: 30}, ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		if err := data.Value.Validate(); (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package reminder
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/pkg/errors"
+)
+
+// DefaultOffsets is the reminder schedule used when none is configured
+const DefaultOffsets = "7,3,1"
+
+// Channels reminders can be sent through
+const (
+	ChannelEmail = "email"
+	// ChannelNone is written in place of a list of channels to send nothing
+	ChannelNone = "none"
+)
+
+// Reminder describes the email sent to a subscriber a number of days from expiry
+type Reminder struct {
+	// Offset is the number of days left on the subscription. Negative values mean the subscription
+	// expired that many days ago.
+	Offset   int
+	Subject  string
+	Template string
+	// Stage names the lifecycle email this is, e.g. StageExpired. It is empty for plain reminders.
+	Stage string
+}
+
+// Policy decides which reminder, if any, a subscriber should get
+type Policy struct {
+	// Channels the reminders are sent through. Reminders are still scheduled, but not sent, if there are none.
+	Channels []string
+
+	reminders map[int]Reminder
+}
+
+// NewPolicy creates a Policy from a list of reminders, sent by email.
+// A later reminder replaces an earlier one with the same offset.
+func NewPolicy(reminders ...Reminder) Policy {
+	p := Policy{Channels: []string{ChannelEmail}, reminders: make(map[int]Reminder, len(reminders))}
+	for _, r := range reminders {
+		p.reminders[r.Offset] = r
+	}
+	return p
+}
+
+// Reminder returns the reminder due for a subscription with daysLeft days to expiry.
+// The second return value is false if no reminder is scheduled for that day.
+func (p Policy) Reminder(daysLeft int) (Reminder, bool) {
+	r, ok := p.reminders[daysLeft]
+	return r, ok
+}
+
+// Due returns the reminder due for entry as of the time given by clock.
+// The second return value is false if no reminder is scheduled for that day.
+func (p Policy) Due(entry sheetdata.SheetEntry, clock sheetdata.Clock) (Reminder, bool) {
+	return p.Reminder(entry.DaysLeftAt(clock.Now()))
+}
+
+// Offsets returns the scheduled offsets from the furthest before expiry to the furthest after
+func (p Policy) Offsets() []int {
+	offsets := make([]int, 0, len(p.reminders))
+	for offset := range p.reminders {
+		offsets = append(offsets, offset)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	return offsets
+}
+
+// Sends reports whether the reminders are sent through channel
+func (p Policy) Sends(channel string) bool {
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseChannels parses a comma-separated list of channels such as "email". "none" is an empty list.
+func ParseChannels(list string) ([]string, error) {
+	channels := []string{}
+	for _, field := range strings.Split(list, ",") {
+		switch field = strings.ToLower(strings.TrimSpace(field)); field {
+		case "":
+		case ChannelEmail:
+			channels = append(channels, field)
+		case ChannelNone:
+			if len(strings.Split(list, ",")) > 1 {
+				return nil, errors.Errorf("%q can't be combined with other channels", ChannelNone)
+			}
+		default:
+			return nil, errors.Errorf("Unknown channel %q. The channels are %q and %q", field, ChannelEmail, ChannelNone)
+		}
+	}
+	if len(channels) == 0 && strings.ToLower(strings.TrimSpace(list)) != ChannelNone {
+		return nil, errors.Errorf("No channels in %q. Use %q to send nothing", list, ChannelNone)
+	}
+	return channels, nil
+}
+
+// ParseOffsets parses a comma-separated list of day offsets such as "14,7,3,1,0,-1,-3"
+func ParseOffsets(list string) ([]int, error) {
+	var offsets []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		offset, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, errors.Errorf("Invalid reminder offset %q", field)
+		}
+		offsets = append(offsets, offset)
+	}
+	if len(offsets) == 0 {
+		return nil, errors.Errorf("No reminder offsets in %q", list)
+	}
+	return offsets, nil
+}
+
+// OffsetKey returns the suffix used to name per-offset settings, e.g. "7" for 7 and "NEG_1" for -1
+func OffsetKey(offset int) string {
+	if offset < 0 {
+		return "NEG_" + strconv.Itoa(-offset)
+	}
+	return strconv.Itoa(offset)
+}
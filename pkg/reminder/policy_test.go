@@ -0,0 +1,120 @@
+package reminder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+)
+
+func TestPolicyReminder(t *testing.T) {
+	policy := NewPolicy(
+		Reminder{Offset: 7, Subject: "A week left"},
+		Reminder{Offset: 3},
+		Reminder{Offset: 1},
+		Reminder{Offset: -1, Subject: "Expired yesterday"},
+	)
+	testCases := map[string]struct {
+		Value           int
+		ExpectedResult  bool
+		ExpectedSubject string
+	}{
+		"Zero should be false":              {Value: 0, ExpectedResult: false},
+		"Equal to 1 should be true":         {Value: 1, ExpectedResult: true},
+		"Equal to 3 should be true":         {Value: 3, ExpectedResult: true},
+		"Equal to 7 should be true":         {Value: 7, ExpectedResult: true, ExpectedSubject: "A week left"},
+		"Scheduled negative should be true": {Value: -1, ExpectedResult: true, ExpectedSubject: "Expired yesterday"},
+		"Other negative should be false":    {Value: -2, ExpectedResult: false},
+		"Any other number should be false":  {Value: 20, ExpectedResult: false},
+	}
+	for testcase, data := range testCases {
+		got, ok := policy.Reminder(data.Value)
+		if ok != data.ExpectedResult {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.ExpectedResult, ok)
+		}
+		if got.Subject != data.ExpectedSubject {
+			t.Errorf("%s\n\tExpected subject: %q, Got: %q\n", testcase, data.ExpectedSubject, got.Subject)
+		}
+	}
+}
+
+func TestPolicyOffsets(t *testing.T) {
+	policy := NewPolicy(Reminder{Offset: -3}, Reminder{Offset: 14}, Reminder{Offset: 0}, Reminder{Offset: 3})
+	expected := []int{14, 3, 0, -3}
+	if got := policy.Offsets(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestParseOffsets(t *testing.T) {
+	testCases := map[string]struct {
+		Value       string
+		Expected    []int
+		ExpectError bool
+	}{
+		"Default schedule":       {Value: DefaultOffsets, Expected: []int{7, 3, 1}},
+		"Negative and spaces":    {Value: "14, 7,3,1,0,-1 ,-3", Expected: []int{14, 7, 3, 1, 0, -1, -3}},
+		"Not a number":           {Value: "7,three", ExpectError: true},
+		"Empty list should fail": {Value: " , ", ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		got, err := ParseOffsets(data.Value)
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if !data.ExpectError && !reflect.DeepEqual(got, data.Expected) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestPolicyDue(t *testing.T) {
+	lagos := sheetdata.DefaultLocation()
+	policy := NewPolicy(Reminder{Offset: 7}, Reminder{Offset: 0}, Reminder{Offset: -1})
+	entry := sheetdata.SheetEntry{EndDate: time.Date(2024, time.May, 8, 0, 0, 0, 0, lagos)}
+	testCases := map[string]struct {
+		AsOf           time.Time
+		ExpectedResult bool
+		ExpectedOffset int
+	}{
+		"A week before":      {AsOf: time.Date(2024, time.May, 1, 9, 0, 0, 0, lagos), ExpectedResult: true, ExpectedOffset: 7},
+		"Six days before":    {AsOf: time.Date(2024, time.May, 2, 9, 0, 0, 0, lagos), ExpectedResult: false},
+		"On the end date":    {AsOf: time.Date(2024, time.May, 8, 23, 0, 0, 0, lagos), ExpectedResult: true, ExpectedOffset: 0},
+		"Day after end date": {AsOf: time.Date(2024, time.May, 9, 0, 0, 0, 0, lagos), ExpectedResult: true, ExpectedOffset: -1},
+	}
+	for testcase, data := range testCases {
+		got, ok := policy.Due(entry, sheetdata.FixedClock(data.AsOf))
+		if ok != data.ExpectedResult || (ok && got.Offset != data.ExpectedOffset) {
+			t.Errorf("%s\n\tExpected: %v %d, Got: %v %d\n", testcase, data.ExpectedResult, data.ExpectedOffset, ok, got.Offset)
+		}
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	testCases := map[string]struct {
+		Value       string
+		Expected    []string
+		ExpectError bool
+	}{
+		"Email":                     {Value: " Email ", Expected: []string{ChannelEmail}},
+		"None":                      {Value: "none", Expected: []string{}},
+		"Unknown channel":           {Value: "email,sms", ExpectError: true},
+		"None with another channel": {Value: "email,none", ExpectError: true},
+		"Empty list should fail":    {Value: " , ", ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		got, err := ParseChannels(data.Value)
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if !data.ExpectError && !reflect.DeepEqual(got, data.Expected) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+	if p := NewPolicy(); !p.Sends(ChannelEmail) {
+		t.Errorf("Expected a new policy to send email, Got: %v", p.Channels)
+	}
+}
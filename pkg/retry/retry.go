@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// Default settings of a Policy
+const (
+	DefaultAttempts = 4
+	DefaultBase     = time.Second
+	DefaultMax      = 30 * time.Second
+)
+
+// StatusError is an error from an HTTP API that carries the response status and headers
+type StatusError interface {
+	error
+	StatusCode() int
+	Header() http.Header
+}
+
+// Policy retries failed calls with jittered exponential backoff
+type Policy struct {
+	// Attempts is the most times a call is made, including the first. Less than 1 means 1.
+	Attempts int
+	// Base is the delay before the first retry. It doubles for every retry after that.
+	Base time.Duration
+	// Max caps the delay between attempts. A Retry-After longer than Max gives up instead of waiting.
+	Max time.Duration
+}
+
+// DefaultPolicy makes up to four attempts, waiting about one, two and four seconds in between
+var DefaultPolicy = Policy{Attempts: DefaultAttempts, Base: DefaultBase, Max: DefaultMax}
+
+// sleep waits for d or until ctx is done. Tests replace it to run without waiting.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable, runs out of attempts or ctx is done.
+// It returns the error of the last attempt.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts {
+			return err
+		}
+		ok, after := Retryable(err)
+		if !ok {
+			return err
+		}
+		delay := p.backoff(attempt)
+		if after > delay {
+			if p.Max > 0 && after > p.Max {
+				return errors.WithMessage(err, "Retry-After "+after.String()+" is too long to wait")
+			}
+			delay = after
+		}
+		if sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// backoff is the delay before the given retry: a random duration between half and all of Base * 2^(retry-1),
+// capped at Max
+func (p Policy) backoff(retry int) time.Duration {
+	d := p.Base << uint(retry-1)
+	if d <= 0 || (p.Max > 0 && d > p.Max) {
+		d = p.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Retryable reports whether err is worth retrying, and how long the server asked to wait first if it said so.
+// Google API errors and StatusErrors are retried on 408, 429 and 5xx statuses, and on 403 when the reason is a
+// rate limit. Network errors are retried when they are timeouts or temporary.
+func Retryable(err error) (bool, time.Duration) {
+	switch e := errors.Cause(err).(type) {
+	case *googleapi.Error:
+		if e.Code == http.StatusForbidden {
+			for _, item := range e.Errors {
+				if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+					return true, RetryAfter(e.Header)
+				}
+			}
+			return false, 0
+		}
+		return retryableStatus(e.Code), RetryAfter(e.Header)
+	case StatusError:
+		return retryableStatus(e.StatusCode()), RetryAfter(e.Header())
+	case net.Error:
+		return e.Timeout() || e.Temporary(), 0
+	}
+	return false, 0
+}
+
+// Permanent reports whether err is a response from an API that Retryable won't retry, such as a 400 or 401, so that
+// making the same call on a later run won't help either. Errors without a status, e.g. network errors, aren't permanent.
+func Permanent(err error) bool {
+	switch errors.Cause(err).(type) {
+	case *googleapi.Error, StatusError:
+		ok, _ := Retryable(err)
+		return !ok
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// RetryAfter reads the Retry-After header, given either in seconds or as an HTTP date.
+// It returns 0 if the header is missing or invalid.
+func RetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
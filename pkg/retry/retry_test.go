@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// statusError is a StatusError with a fixed status
+type statusError struct {
+	code   int
+	header http.Header
+}
+
+func (e statusError) Error() string       { return http.StatusText(e.code) }
+func (e statusError) StatusCode() int     { return e.code }
+func (e statusError) Header() http.Header { return e.header }
+
+func TestRetryable(t *testing.T) {
+	testCases := map[string]struct {
+		Err           error
+		Expected      bool
+		ExpectedAfter time.Duration
+		Permanent     bool
+	}{
+		"Sheets 503": {Err: &googleapi.Error{Code: 503}, Expected: true},
+		"Sheets 429 with Retry-After": {
+			Err:           errors.WithMessage(&googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"7"}}}, "Unable to read"),
+			Expected:      true,
+			ExpectedAfter: 7 * time.Second,
+		},
+		"Sheets rate limit 403": {
+			Err:      &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}},
+			Expected: true,
+		},
+		"Sheets permission 403": {Err: &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, Permanent: true},
+		"Sheets 404":            {Err: &googleapi.Error{Code: 404}, Permanent: true},
+		"SendGrid 429":          {Err: statusError{code: 429, header: http.Header{"Retry-After": {"2"}}}, Expected: true, ExpectedAfter: 2 * time.Second},
+		"SendGrid 500":          {Err: statusError{code: 500}, Expected: true},
+		"SendGrid 400":          {Err: statusError{code: 400}, Permanent: true},
+		"SendGrid 401":          {Err: errors.WithMessage(statusError{code: 401}, "Unable to send"), Permanent: true},
+		"Other error":           {Err: errors.New("Cannot execute HTML template.")},
+	}
+	for testcase, data := range testCases {
+		got, after := Retryable(data.Err)
+		if got != data.Expected || after != data.ExpectedAfter {
+			t.Errorf("%s\n\tExpected: %v %v, Got: %v %v\n", testcase, data.Expected, data.ExpectedAfter, got, after)
+		}
+		if got := Permanent(data.Err); got != data.Permanent {
+			t.Errorf("%s\n\tExpected permanent: %v, Got: %v\n", testcase, data.Permanent, got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	var waits []time.Duration
+	defer func(original func(context.Context, time.Duration) error) { sleep = original }(sleep)
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	policy := Policy{Attempts: 4, Base: time.Second, Max: 10 * time.Second}
+
+	testCases := map[string]struct {
+		Errs             []error
+		ExpectedCalls    int
+		ExpectedErr      bool
+		ExpectedMinWaits []time.Duration
+	}{
+		"Succeeds first time": {Errs: []error{nil}, ExpectedCalls: 1},
+		"Succeeds after retries": {
+			Errs:             []error{statusError{code: 503}, statusError{code: 503}, nil},
+			ExpectedCalls:    3,
+			ExpectedMinWaits: []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		"Gives up": {
+			Errs:             []error{statusError{code: 503}, statusError{code: 503}, statusError{code: 503}, statusError{code: 503}},
+			ExpectedCalls:    4,
+			ExpectedErr:      true,
+			ExpectedMinWaits: []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second},
+		},
+		"Not retryable": {Errs: []error{statusError{code: 400}}, ExpectedCalls: 1, ExpectedErr: true},
+		"Honors Retry-After": {
+			Errs:             []error{statusError{code: 429, header: http.Header{"Retry-After": {"5"}}}, nil},
+			ExpectedCalls:    2,
+			ExpectedMinWaits: []time.Duration{5 * time.Second},
+		},
+		"Retry-After too long": {
+			Errs:          []error{statusError{code: 429, header: http.Header{"Retry-After": {"60"}}}},
+			ExpectedCalls: 1,
+			ExpectedErr:   true,
+		},
+	}
+	for testcase, data := range testCases {
+		waits = nil
+		calls := 0
+		err := policy.Do(context.Background(), func() error {
+			calls++
+			return data.Errs[calls-1]
+		})
+		if calls != data.ExpectedCalls || (err != nil) != data.ExpectedErr {
+			t.Errorf("%s\n\tExpected: %d calls (error %v), Got: %d calls (%v)\n", testcase, data.ExpectedCalls, data.ExpectedErr, calls, err)
+		}
+		if len(waits) != len(data.ExpectedMinWaits) {
+			t.Errorf("%s\n\tExpected: %d waits, Got: %v\n", testcase, len(data.ExpectedMinWaits), waits)
+			continue
+		}
+		for i, min := range data.ExpectedMinWaits {
+			if waits[i] < min || waits[i] > 2*min {
+				t.Errorf("%s\n\tExpected: wait %d between %v and %v, Got: %v\n", testcase, i, min, 2*min, waits[i])
+			}
+		}
+	}
+
+	// A cancelled context stops retrying and returns the last error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := policy.Do(ctx, func() error {
+		calls++
+		return statusError{code: 503}
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("Expected 1 call and an error after cancelling, Got: %d (%v)", calls, err)
+	}
+}
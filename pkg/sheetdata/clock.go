@@ -0,0 +1,25 @@
+package sheetdata
+
+import "time"
+
+// Clock tells the current time, so that reminders can be evaluated as of any day
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is a Clock that returns the system time
+var SystemClock Clock = systemClock{}
+
+// FixedClock is a Clock that always returns the same time
+type FixedClock time.Time
+
+// Now returns the fixed time
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
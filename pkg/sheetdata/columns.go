@@ -0,0 +1,87 @@
+package sheetdata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Fields of the spreadsheet that are looked up by header name
+const (
+	FieldFirstName = "First Name"
+	FieldLastName  = "Last Name"
+	FieldEmail     = "Email"
+	FieldEndDate   = "End Date"
+	// FieldPlan is the optional column naming the subscription plan, e.g. "Weekly"
+	FieldPlan = "Plan"
+	// FieldReminderStatus is the optional column the outcome of each reminder is written back to
+	FieldReminderStatus = "Reminder Status"
+)
+
+// Aliases maps a field to the header names it may appear under in the spreadsheet
+type Aliases map[string][]string
+
+// DefaultAliases returns the header names recognised for each field when none are configured
+func DefaultAliases() Aliases {
+	return Aliases{
+		FieldFirstName: {"First Name", "Firstname", "Given Name"},
+		FieldLastName:  {"Last Name", "Lastname", "Surname"},
+		FieldEmail:     {"Email", "Email Address", "E-mail"},
+		FieldEndDate:   {"End Date", "Expiry Date", "Expiration Date"},
+		FieldPlan:      {"Plan", "Plan Type", "Subscription Plan"},
+
+		FieldReminderStatus: {"Reminder Status", "Last Reminder"},
+	}
+}
+
+// Add appends extra header names for field, keeping the existing ones
+func (a Aliases) Add(field string, names ...string) {
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			a[field] = append(a[field], name)
+		}
+	}
+}
+
+// requiredFields must be present in the header row for a sheet to be usable
+var requiredFields = []string{FieldFirstName, FieldEmail, FieldEndDate}
+
+// Columns maps each field to its zero-based index in a spreadsheet row
+type Columns map[string]int
+
+// NewColumns finds the column of each field in the header row using the given aliases.
+// Header names are matched case-insensitively and ignoring surrounding whitespace.
+// It returns an error naming every required field that has no matching header.
+func NewColumns(header []interface{}, aliases Aliases) (Columns, error) {
+	index := make(map[string]int, len(header))
+	for i, cell := range header {
+		name := normaliseHeader(fmt.Sprint(cell))
+		if _, seen := index[name]; !seen && name != "" {
+			index[name] = i
+		}
+	}
+	columns := Columns{}
+	for field, names := range aliases {
+		for _, name := range names {
+			if i, ok := index[normaliseHeader(name)]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	var missing []string
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, fmt.Sprintf("%q", field))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.Errorf("Missing required header(s) %s in the first row of the sheet", strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+func normaliseHeader(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,72 @@
+package sheetdata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDateLayouts are the layouts tried, in order, for end dates written as text.
+// Day-first layouts come before month-first ones, as dates are written in Nigeria.
+var DefaultDateLayouts = []string{
+	"2/1/06",
+	"2/1/2006",
+	"2006-01-02",
+	"2-1-2006",
+	"2.1.2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// serialEpoch is day zero of spreadsheet serial dates, as used by Google Sheets and Excel
+var serialEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// DateError reports a value that could not be parsed as a date
+type DateError struct {
+	Value   interface{}
+	Layouts []string
+}
+
+func (e *DateError) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return fmt.Sprintf("Cannot parse %q as a date. Expected one of the layouts %s", s, strings.Join(e.Layouts, ", "))
+	}
+	return fmt.Sprintf("Cannot parse %v (%T) as a date", e.Value, e.Value)
+}
+
+// TimeFromSheet converts a date from the spreadsheet to a time.Time value at midnight in loc.
+// The value may be text in one of the layouts, tried in order, or a serial date number as returned by the Sheets API
+// for the UNFORMATTED_VALUE render option. If the conversion fails it returns the zero time and a *DateError.
+func TimeFromSheet(value interface{}, layouts []string, loc *time.Location) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		return timeFromSerial(v, loc, value, layouts)
+	case int:
+		return timeFromSerial(float64(v), loc, value, layouts)
+	case string:
+		date := strings.Join(strings.Fields(v), " ")
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+				return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+			}
+		}
+		// Serial numbers may also arrive as text, e.g. from a CSV export
+		if n, err := strconv.ParseFloat(date, 64); err == nil {
+			return timeFromSerial(n, loc, value, layouts)
+		}
+	}
+	return time.Time{}, &DateError{Value: value, Layouts: layouts}
+}
+
+func timeFromSerial(serial float64, loc *time.Location, value interface{}, layouts []string) (time.Time, error) {
+	// Only the whole days matter; the fraction is the time of day
+	if math.IsNaN(serial) || serial < 1 || serial > 2958465 {
+		return time.Time{}, &DateError{Value: value, Layouts: layouts}
+	}
+	t := serialEpoch.AddDate(0, 0, int(serial))
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+}
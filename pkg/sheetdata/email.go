@@ -0,0 +1,211 @@
+package sheetdata
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// KnownDomains are common email domains of hub members. Addresses at a domain a small typo away from one of these,
+// such as gmial.com, are still sent to, but SuggestEmail offers a correction for staff to check.
+var KnownDomains = []string{
+	"gmail.com", "googlemail.com", "yahoo.com", "yahoo.co.uk", "ymail.com", "rocketmail.com",
+	"hotmail.com", "hotmail.co.uk", "outlook.com", "live.com", "msn.com", "icloud.com", "me.com", "mac.com",
+	"aol.com", "mail.com", "gmx.com", "protonmail.com", "proton.me", "zoho.com", "yandex.com",
+	// Nigerian providers and institutions
+	"yahoo.com.ng", "sprinthub.com.ng", "uniport.edu.ng", "unilag.edu.ng", "ui.edu.ng", "oauife.edu.ng",
+	"unn.edu.ng", "rsu.edu.ng", "nigerianbar.ng", "mtn.com", "mtnnigeria.net",
+}
+
+// EmailError reports an email address that can't be used, with a likely correction if there is one
+type EmailError struct {
+	Value      string
+	Suggestion string
+}
+
+func (e *EmailError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("%q is not a valid email address, did you mean %s?", e.Value, e.Suggestion)
+	}
+	return fmt.Sprintf("%q is not a valid email address", e.Value)
+}
+
+// ParseEmails reads the addresses in an email cell. A cell may hold several addresses separated by ";" or ",".
+// Addresses are trimmed and lower cased, and must be plain addresses (RFC 5322 addr-spec) with a dotted domain.
+// The first invalid address is returned as an *EmailError.
+func ParseEmails(cell string) ([]string, error) {
+	parts := strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == ',' })
+	emails := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if part == "" {
+			continue
+		}
+		// "ada@gmail,com" is a comma typed for a dot, not two addresses
+		if i+1 < len(parts) && strings.Contains(part, "@") && !strings.Contains(part[strings.LastIndex(part, "@"):], ".") &&
+			!strings.Contains(parts[i+1], "@") {
+			next := strings.TrimSpace(parts[i+1])
+			suggestion, err := NormaliseEmail(part + "." + next)
+			if emailErr, ok := err.(*EmailError); ok {
+				suggestion = emailErr.Suggestion
+			} else if s := SuggestEmail(suggestion); s != "" {
+				suggestion = s
+			}
+			return nil, &EmailError{Value: part + "," + next, Suggestion: suggestion}
+		}
+		email, err := NormaliseEmail(part)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	if len(emails) == 0 {
+		return nil, &EmailError{Value: cell}
+	}
+	return emails, nil
+}
+
+// NormaliseEmail checks a single address and returns it trimmed and lower cased. A malformed address is returned as
+// an *EmailError, with a suggestion if there is a likely correction. Addresses at a domain that only looks like a typo
+// of a known domain are valid; see SuggestEmail.
+func NormaliseEmail(value string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(value))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", &EmailError{Value: value, Suggestion: suggest(email)}
+	}
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", &EmailError{Value: value, Suggestion: suggest(email)}
+	}
+	return email, nil
+}
+
+// SuggestEmail returns a likely correction of a valid address at a domain that looks like a typo of a known domain,
+// e.g. ada@gmail.com for ada@gmial.com, or "" if there is none. The address may well be real, so it is only a
+// suggestion for staff to check.
+func SuggestEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	if suggestion := suggestDomain(email[at+1:]); suggestion != "" {
+		return email[:at+1] + suggestion
+	}
+	return ""
+}
+
+// suggest returns a likely correction of a malformed address, or "" if there is none
+func suggest(value string) string {
+	email := strings.ToLower(strings.TrimSpace(value))
+	// Spaces, commas and doubled dots are the usual slips
+	email = strings.NewReplacer(" ", "", ",", ".", "..", ".").Replace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return ""
+	}
+	local, domain := email[:at], strings.Trim(email[at+1:], ".")
+	if suggestion := suggestDomain(domain); suggestion != "" {
+		domain = suggestion
+	}
+	candidate := local + "@" + domain
+	if addr, err := mail.ParseAddress(candidate); err != nil || addr.Address != candidate || !strings.Contains(domain, ".") {
+		return ""
+	}
+	if candidate == strings.ToLower(strings.TrimSpace(value)) {
+		return ""
+	}
+	return candidate
+}
+
+// tldTypos are misspellings of ".com"
+var tldTypos = map[string]string{"con": "com", "cmo": "com", "ocm": "com", "comm": "com", "vom": "com", "xom": "com"}
+
+// suggestDomain returns the known domain that domain is most likely a typo of, or "" if it is known or not close
+// to any known domain. Only the names of domains with the same ending are compared letter by letter, e.g. gmial
+// with gmail in gmial.com: another ending, as in yahoo.ca, is usually a real domain, and short names such as aol or
+// rsu are a letter or two away from other real ones, such as abu.edu.ng. Missing dots or endings, as in "gmailcom" or
+// "gmail", and misspelt ".com" endings are also caught.
+func suggestDomain(domain string) string {
+	for _, known := range KnownDomains {
+		if domain == known {
+			return ""
+		}
+	}
+	name, ending := splitDomain(domain)
+	best, bestDistance := "", 0
+	for _, known := range KnownDomains {
+		if strings.Replace(known, ".", "", -1) == domain || known == domain+".com" {
+			return known
+		}
+		knownName, knownEnding := splitDomain(known)
+		if ending != knownEnding || len(knownName) < 5 {
+			continue
+		}
+		limit := 1
+		if len(knownName) >= 8 {
+			limit = 2
+		}
+		if d := editDistance(name, knownName); d <= limit && (best == "" || d < bestDistance) {
+			best, bestDistance = known, d
+		}
+	}
+	if best != "" {
+		return best
+	}
+	if dot := strings.LastIndex(domain, "."); dot >= 0 {
+		if fix, ok := tldTypos[domain[dot+1:]]; ok {
+			fixed := domain[:dot+1] + fix
+			if s := suggestDomain(fixed); s != "" {
+				return s
+			}
+			return fixed
+		}
+	}
+	return ""
+}
+
+// splitDomain splits a domain into its name and ending at the first dot, e.g. "yahoo" and "co.uk"
+func splitDomain(domain string) (string, string) {
+	if dot := strings.Index(domain, "."); dot >= 0 {
+		return domain[:dot], domain[dot+1:]
+	}
+	return domain, ""
+}
+
+// editDistance is the optimal string alignment distance between a and b: the number of insertions,
+// deletions, substitutions and swaps of adjacent characters that turn one into the other
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
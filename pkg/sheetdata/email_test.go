@@ -0,0 +1,74 @@
+package sheetdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEmails(t *testing.T) {
+	testCases := map[string]struct {
+		Cell               string
+		Expected           []string
+		ExpectedSuggestion string
+		ExpectError        bool
+	}{
+		"Plain address":            {Cell: "ada@example.com", Expected: []string{"ada@example.com"}},
+		"Spaces and capitals":      {Cell: "  Ada.Obi@Example.COM ", Expected: []string{"ada.obi@example.com"}},
+		"Semicolon separated":      {Cell: "ada@example.com; bola@gmail.com", Expected: []string{"ada@example.com", "bola@gmail.com"}},
+		"Comma separated":          {Cell: "ada@example.com,bola@yahoo.com,", Expected: []string{"ada@example.com", "bola@yahoo.com"}},
+		"Nigerian domain":          {Cell: "ada@uniport.edu.ng", Expected: []string{"ada@uniport.edu.ng"}},
+		"Short domain not guessed": {Cell: "ada@aon.com", Expected: []string{"ada@aon.com"}},
+		"Comma for a dot":          {Cell: "name@gmail,com", ExpectedSuggestion: "name@gmail.com", ExpectError: true},
+		"Comma for a dot and typo": {Cell: "name@gmial,com", ExpectedSuggestion: "name@gmail.com", ExpectError: true},
+		"Missing dot":              {Cell: "ada@hotmailcom", ExpectedSuggestion: "ada@hotmail.com", ExpectError: true},
+		"Missing ending":           {Cell: "ada@gmail", ExpectedSuggestion: "ada@gmail.com", ExpectError: true},
+		"Space inside":             {Cell: "ada obi@gmail.com", ExpectedSuggestion: "adaobi@gmail.com", ExpectError: true},
+		"Likely typo is kept":      {Cell: "ada@gmial.com", Expected: []string{"ada@gmial.com"}},
+		"Domain near a known one":  {Cell: "ada@lasu.edu.ng; bola@abu.edu.ng", Expected: []string{"ada@lasu.edu.ng", "bola@abu.edu.ng"}},
+		"Other Yahoo domains":      {Cell: "ada@yahoo.ca, bola@yahoo.co.in, chidi@yahoo.co.za", Expected: []string{"ada@yahoo.ca", "bola@yahoo.co.in", "chidi@yahoo.co.za"}},
+		"Second address bad":       {Cell: "ada@example.com; bola@", ExpectError: true},
+		"No address":               {Cell: " ; ", ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		got, err := ParseEmails(data.Cell)
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if err != nil {
+			emailErr, ok := err.(*EmailError)
+			if !ok || emailErr.Suggestion != data.ExpectedSuggestion {
+				t.Errorf("%s\n\tExpected: suggestion %q, Got: %#v\n", testcase, data.ExpectedSuggestion, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, data.Expected) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestSuggestEmail(t *testing.T) {
+	testCases := map[string]string{
+		"ada@gmial.com":       "ada@gmail.com",
+		"ada@yaho.com":        "ada@yahoo.com",
+		"ada@hotmal.co.uk":    "ada@hotmail.co.uk",
+		"ada@protonmial.com":  "ada@protonmail.com",
+		"ada@example.con":     "ada@example.com",
+		"ada@gmail.con":       "ada@gmail.com",
+		"ada@gmail.com":       "",
+		"ada@example.com":     "",
+		"ada@lasu.edu.ng":     "",
+		"ada@abu.edu.ng":      "",
+		"ada@yahoo.ca":        "",
+		"ada@yahoo.co.in":     "",
+		"ada@yahoo.co.za":     "",
+		"ada@aon.com":         "",
+		"ada@futminna.edu.ng": "",
+	}
+	for email, expected := range testCases {
+		if got := SuggestEmail(email); got != expected {
+			t.Errorf("SuggestEmail(%q)\n\tExpected: %q, Got: %q\n", email, expected, got)
+		}
+	}
+}
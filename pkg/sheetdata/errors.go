@@ -0,0 +1,33 @@
+package sheetdata
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CellError reports a cell of the spreadsheet whose value could not be used
+type CellError struct {
+	// Field is the column the cell belongs to, e.g. "End Date"
+	Field string
+	// Cell is the A1 address of the cell, e.g. "E12"
+	Cell string
+	Err  error
+}
+
+func (e *CellError) Error() string {
+	return fmt.Sprintf("%s cell %s: %v", e.Field, e.Cell, e.Err)
+}
+
+// Cause returns the underlying error, for use with errors.Cause
+func (e *CellError) Cause() error {
+	return e.Err
+}
+
+// CellName returns the A1 address of a cell from its row number and zero-based column, e.g. "AB12" for 12 and 27
+func CellName(row, column int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
@@ -0,0 +1,25 @@
+package sheetdata
+
+import "time"
+
+// DefaultTimezone is the time zone of the hub when none is configured
+const DefaultTimezone = "Africa/Lagos"
+
+// West Africa Time has been UTC+1 all year round, without daylight saving
+var westAfricaTime = time.FixedZone("WAT", 60*60)
+
+// LoadLocation returns the time zone with the given IANA name, e.g. "Africa/Lagos".
+// Africa/Lagos is available even on systems without a time zone database.
+func LoadLocation(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil && name == DefaultTimezone {
+		return westAfricaTime, nil
+	}
+	return loc, err
+}
+
+// DefaultLocation returns the time zone of DefaultTimezone
+func DefaultLocation() *time.Location {
+	loc, _ := LoadLocation(DefaultTimezone)
+	return loc
+}
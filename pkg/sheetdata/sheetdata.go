@@ -12,8 +12,16 @@ import (
 type SheetEntry struct {
 	FirstName string
 	LastName  string
-	Email     string
-	EndDate   time.Time
+	// Email is the first address in the email cell and Emails all of them, normalised to lower case
+	Email  string
+	Emails []string
+	// EndDate is the last day of the subscription at midnight in the hub's time zone.
+	// The subscription expires at the end of that day.
+	EndDate time.Time
+	// Plan is the subscription plan in lower case, e.g. "weekly", or empty if the sheet has no plan column
+	Plan string
+
+	clock Clock
 }
 
 // FullName returns the first name and the last name separated by a space
@@ -21,61 +29,183 @@ func (s SheetEntry) FullName() string {
 	return s.FirstName + " " + s.LastName
 }
 
-// DaysLeft returns the number of days left until subscription expiry
+// DaysLeft returns the number of days left until subscription expiry, as of the time given by the parser's clock
 func (s SheetEntry) DaysLeft() int {
-	now := time.Now().UTC()
-	return int(s.EndDate.Sub(now).Hours()) / 24
+	if s.clock == nil {
+		return s.DaysLeftAt(time.Now())
+	}
+	return s.DaysLeftAt(s.clock.Now())
 }
 
-// NewSheetEntry constructs a SheetEntry from a row entry in a spreadsheet
-func NewSheetEntry(data []interface{}) (SheetEntry, error) {
-	// Parse the time from the response
-	firstName, ok := data[0].(string)
-	if !ok {
-		return SheetEntry{}, errors.New("Unexpected first name value")
+// DaysLeftAt returns the number of calendar days from now to the end date in the hub's time zone.
+// It is 0 on the last day of the subscription and negative once it has expired.
+func (s SheetEntry) DaysLeftAt(now time.Time) int {
+	y, m, d := now.In(s.EndDate.Location()).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = s.EndDate.Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	// Both dates are UTC midnights, so the difference is a whole number of days even across DST changes
+	return int(end.Sub(today).Hours() / 24)
+}
+
+// Options configures how a Parser reads rows
+type Options struct {
+	// Aliases are the header names of each field. Defaults to DefaultAliases.
+	Aliases Aliases
+	// DateLayouts are tried in order for end dates written as text. Defaults to DefaultDateLayouts.
+	DateLayouts []string
+	// FirstColumn is the zero-based sheet column of the first cell of each row, used to name cells in errors
+	FirstColumn int
+	// Location is the hub's time zone, in which end dates are read. Defaults to Africa/Lagos.
+	Location *time.Location
+	// Clock tells the time that DaysLeft of the parsed entries counts from. Defaults to SystemClock.
+	Clock Clock
+}
+
+// Parser builds SheetEntry values from spreadsheet rows using the columns found in the header row
+type Parser struct {
+	columns     Columns
+	dateLayouts []string
+	firstColumn int
+	location    *time.Location
+	clock       Clock
+}
+
+// NewParser creates a Parser from the header row of the sheet
+func NewParser(header []interface{}, opts Options) (*Parser, error) {
+	if opts.Aliases == nil {
+		opts.Aliases = DefaultAliases()
+	}
+	if len(opts.DateLayouts) == 0 {
+		opts.DateLayouts = DefaultDateLayouts
+	}
+	if opts.Location == nil {
+		opts.Location = DefaultLocation()
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	columns, err := NewColumns(header, opts.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{
+		columns:     columns,
+		dateLayouts: opts.DateLayouts,
+		firstColumn: opts.FirstColumn,
+		location:    opts.Location,
+		clock:       opts.Clock,
+	}, nil
+}
+
+// ErrBlankRow is returned by NewSheetEntry for a row without any values, which sheets often have at the end
+var ErrBlankRow = errors.New("Blank row")
+
+// NewSheetEntry constructs a SheetEntry from a row entry in a spreadsheet.
+// row is the row number in the sheet, used to name the offending cell in a *CellError.
+// Rows may be shorter than the header, as the Sheets API leaves out trailing empty cells, and cells may hold
+// numbers or booleans as well as text.
+func (p *Parser) NewSheetEntry(row int, data []interface{}) (SheetEntry, error) {
+	if blank(data) {
+		return SheetEntry{}, ErrBlankRow
+	}
+	firstName, err := p.text(data, FieldFirstName)
+	if err != nil {
+		return SheetEntry{}, p.cellError(row, FieldFirstName, err)
+	}
+	lastName, err := p.text(data, FieldLastName)
+	if err != nil {
+		return SheetEntry{}, p.cellError(row, FieldLastName, err)
 	}
-	lastName, ok := data[1].(string)
-	if !ok {
-		return SheetEntry{}, errors.New("Unexpected last name value")
+	email, err := p.text(data, FieldEmail)
+	if err != nil {
+		return SheetEntry{}, p.cellError(row, FieldEmail, err)
 	}
-	date, ok := data[4].(string)
-	if !ok {
-		return SheetEntry{}, errors.New("Unexpected date value")
+	if email == "" {
+		return SheetEntry{}, p.cellError(row, FieldEmail, errors.New("Email is empty"))
 	}
-	email, ok := data[3].(string)
-	if !ok || email == "" {
-		return SheetEntry{}, errors.New("Unexpected email value " + email)
+	emails, err := ParseEmails(email)
+	if err != nil {
+		return SheetEntry{}, p.cellError(row, FieldEmail, err)
 	}
-	now := time.Now().UTC()
-	expiryDate, err := TimeFromSheet(date, now)
+	plan, err := p.text(data, FieldPlan)
 	if err != nil {
-		return SheetEntry{}, errors.WithMessage(err, "Bad time value")
+		return SheetEntry{}, p.cellError(row, FieldPlan, err)
+	}
+	endDate := p.Cell(data, FieldEndDate)
+	if text, ok := endDate.(string); endDate == nil || ok && strings.TrimSpace(text) == "" {
+		return SheetEntry{}, p.cellError(row, FieldEndDate, errors.New("End date is empty"))
+	}
+	// Parse the time from the response
+	expiryDate, err := TimeFromSheet(endDate, p.dateLayouts, p.location)
+	if err != nil {
+		return SheetEntry{}, p.cellError(row, FieldEndDate, errors.WithMessage(err, "Bad time value"))
 	}
 	return SheetEntry{
-		Email:     email,
+		Email:     emails[0],
+		Emails:    emails,
 		EndDate:   expiryDate,
 		FirstName: firstName,
 		LastName:  lastName,
+		Plan:      NormalisePlan(plan),
+		clock:     p.clock,
 	}, nil
 }
 
-// TimeFromSheet converts the time gotten from the spreadsheet to a time.Time value
-// If there is a problem during the conversion, it returns a time.Time value with the default zero values
-// and an error. If the conversion succeeds, it returns the converted time and no error.
-func TimeFromSheet(date string, now time.Time) (time.Time, error) {
-	expires := strings.Split(date, "/")
-	y, err := strconv.Atoi("20" + expires[2])
-	if err != nil {
-		return time.Time{}, err
+// NormalisePlan returns a plan name in lower case with single spaces, so "Monthly " and "monthly" are the same plan
+func NormalisePlan(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// text returns the value of field in the row as trimmed text. Empty and missing cells are "".
+func (p *Parser) text(data []interface{}, field string) (string, error) {
+	return CellText(p.Cell(data, field))
+}
+
+// CellText returns a cell value from the sheet as trimmed text. Numbers and booleans are formatted and nil is "".
+func CellText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", errors.Errorf("Unexpected %T value %v", v, v)
 	}
-	mInt, err := strconv.Atoi(expires[1])
-	if err != nil {
-		return time.Time{}, err
+}
+
+// blank reports whether a row has no values other than whitespace
+func blank(data []interface{}) bool {
+	for _, v := range data {
+		if text, ok := v.(string); v != nil && (!ok || strings.TrimSpace(text) != "") {
+			return false
+		}
 	}
-	m := time.Month(mInt)
-	d, err := strconv.Atoi(expires[0])
-	if err != nil {
-		return time.Time{}, err
+	return true
+}
+
+// cellError wraps err in a *CellError naming the cell of field in the given row
+func (p *Parser) cellError(row int, field string, err error) error {
+	return &CellError{Field: field, Cell: CellName(row, p.firstColumn+p.columns[field]), Err: err}
+}
+
+// Column returns the zero-based index of the column holding field, and false if the sheet has no such column
+func (p *Parser) Column(field string) (int, bool) {
+	i, ok := p.columns[field]
+	return i, ok
+}
+
+// Cell returns the value of field in the row, or nil if the column is unmapped or the row is too short
+func (p *Parser) Cell(data []interface{}, field string) interface{} {
+	i, ok := p.columns[field]
+	if !ok || i >= len(data) {
+		return nil
 	}
-	return time.Date(y, m, d, 0, 0, 0, 0, now.Location()).UTC(), nil
+	return data[i]
 }
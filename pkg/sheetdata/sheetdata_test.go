@@ -0,0 +1,238 @@
+package sheetdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewColumns(t *testing.T) {
+	testCases := map[string]struct {
+		Header      []interface{}
+		Expected    Columns
+		ExpectError bool
+	}{
+		"Original layout": {
+			Header:   []interface{}{"First Name", "Last Name", "Phone", "Email", "End Date"},
+			Expected: Columns{FieldFirstName: 0, FieldLastName: 1, FieldEmail: 3, FieldEndDate: 4},
+		},
+		"Inserted column and aliases": {
+			Header:   []interface{}{"Timestamp", " first  name ", "Surname", "Email Address", "Plan", "Expiry Date"},
+			Expected: Columns{FieldFirstName: 1, FieldLastName: 2, FieldEmail: 3, FieldPlan: 4, FieldEndDate: 5},
+		},
+		"Last name is optional": {
+			Header:   []interface{}{"Email", "First Name", "End Date"},
+			Expected: Columns{FieldFirstName: 1, FieldEmail: 0, FieldEndDate: 2},
+		},
+		"Missing email should fail": {
+			Header:      []interface{}{"First Name", "Last Name", "End Date"},
+			ExpectError: true,
+		},
+	}
+	for testcase, data := range testCases {
+		got, err := NewColumns(data.Header, DefaultAliases())
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if len(got) != len(data.Expected) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+			continue
+		}
+		for field, i := range data.Expected {
+			if got[field] != i {
+				t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.Expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestParserNewSheetEntry(t *testing.T) {
+	parser, err := NewParser([]interface{}{"Phone", "Email", "First Name", "Last Name", "End Date"}, Options{FirstColumn: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	entry, err := parser.NewSheetEntry(2, []interface{}{"0800", "ada@example.com", "Ada", "Obi", "01/05/24"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if entry.Email != "ada@example.com" || entry.FullName() != "Ada Obi" {
+		t.Errorf("Expected Ada Obi <ada@example.com>, Got: %s <%s>", entry.FullName(), entry.Email)
+	}
+	if entry.Plan != "" {
+		t.Errorf("Expected no plan without a plan column, Got: %q", entry.Plan)
+	}
+	withPlan, err := NewParser([]interface{}{"First Name", "Email", "End Date", "Plan Type"}, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if entry, err = withPlan.NewSheetEntry(2, []interface{}{"Ada", "ada@example.com", "01/05/24", " Annual  Plus "}); err != nil || entry.Plan != "annual plus" {
+		t.Errorf("Expected the annual plus plan, Got: %q %v", entry.Plan, err)
+	}
+	if _, err := parser.NewSheetEntry(3, []interface{}{"0800", "", "Ada", "Obi", "01/05/24"}); err == nil {
+		t.Errorf("Expected an error for an empty email")
+	}
+	_, err = parser.NewSheetEntry(12, []interface{}{"0800", "ada@example.com", "Ada", "Obi", "soon"})
+	cellErr, ok := err.(*CellError)
+	if !ok || cellErr.Cell != "F12" || cellErr.Field != FieldEndDate {
+		t.Errorf("Expected a *CellError for cell F12, Got: %#v", err)
+	}
+	if _, ok := errors.Cause(err).(*DateError); !ok {
+		t.Errorf("Expected a *DateError cause, Got: %#v", errors.Cause(err))
+	}
+}
+
+func TestParserUntidyRows(t *testing.T) {
+	parser, err := NewParser([]interface{}{"First Name", "Last Name", "Email", "End Date", "Notes"}, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	testCases := map[string]struct {
+		Row           []interface{}
+		ExpectedName  string
+		ExpectedEmail string
+		ExpectedCell  string
+		ExpectedErr   error
+	}{
+		"Trailing empty cells left out": {
+			Row:           []interface{}{"Ada", "", "ada@example.com", "01/05/24"},
+			ExpectedName:  "Ada ",
+			ExpectedEmail: "ada@example.com",
+		},
+		"Numbers, booleans and spaces": {
+			Row:           []interface{}{float64(7), true, " ada@example.com ", float64(45413)},
+			ExpectedName:  "7 true",
+			ExpectedEmail: "ada@example.com",
+		},
+		"Two addresses": {
+			Row:           []interface{}{"Ada", "Obi", "Ada@Example.com; ada@work.example.com", "01/05/24"},
+			ExpectedName:  "Ada Obi",
+			ExpectedEmail: "ada@example.com",
+		},
+		"Email at a domain like a known one": {
+			Row:           []interface{}{"Ada", "Obi", "ada@lasu.edu.ng", "01/05/24"},
+			ExpectedName:  "Ada Obi",
+			ExpectedEmail: "ada@lasu.edu.ng",
+		},
+		"Malformed email":             {Row: []interface{}{"Ada", "Obi", "ada obi@gmail.com", "01/05/24"}, ExpectedCell: "C5"},
+		"Row too short for the email": {Row: []interface{}{"Ada", "Obi"}, ExpectedCell: "C5"},
+		"Empty end date":              {Row: []interface{}{"Ada", "Obi", "ada@example.com", " "}, ExpectedCell: "D5"},
+		"Missing end date":            {Row: []interface{}{"Ada", nil, "ada@example.com"}, ExpectedCell: "D5"},
+		"Unexpected value":            {Row: []interface{}{map[string]interface{}{}, "Obi", "ada@example.com", "01/05/24"}, ExpectedCell: "A5"},
+		"Blank row":                   {Row: []interface{}{"", " ", nil}, ExpectedErr: ErrBlankRow},
+		"Empty row":                   {Row: []interface{}{}, ExpectedErr: ErrBlankRow},
+	}
+	for testcase, data := range testCases {
+		entry, err := parser.NewSheetEntry(5, data.Row)
+		switch {
+		case data.ExpectedErr != nil:
+			if err != data.ExpectedErr {
+				t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, data.ExpectedErr, err)
+			}
+		case data.ExpectedCell != "":
+			if cellErr, ok := err.(*CellError); !ok || cellErr.Cell != data.ExpectedCell {
+				t.Errorf("%s\n\tExpected: error in cell %s, Got: %v\n", testcase, data.ExpectedCell, err)
+			}
+		case err != nil:
+			t.Errorf("%s\n\tUnexpected error: %+v\n", testcase, err)
+		case entry.FullName() != data.ExpectedName || entry.Email != data.ExpectedEmail:
+			t.Errorf("%s\n\tExpected: %s <%s>, Got: %s <%s>\n", testcase, data.ExpectedName, data.ExpectedEmail, entry.FullName(), entry.Email)
+		}
+	}
+}
+
+func TestTimeFromSheet(t *testing.T) {
+	may1 := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		Value       interface{}
+		ExpectError bool
+	}{
+		"Two digit year":        {Value: "01/05/24"},
+		"Single digits":         {Value: "1/5/24"},
+		"Four digit year":       {Value: "01/05/2024"},
+		"ISO date":              {Value: "2024-05-01"},
+		"Long month":            {Value: "1 May 2024"},
+		"Extra spaces":          {Value: " 1  May 2024 "},
+		"Dashes":                {Value: "1-5-2024"},
+		"Month first with name": {Value: "May 1, 2024"},
+		"Serial number":         {Value: 45413.0},
+		"Serial with time":      {Value: 45413.75},
+		"Serial as text":        {Value: "45413"},
+		"Integer serial":        {Value: 45413},
+		"Missing year":          {Value: "01/05", ExpectError: true},
+		"Empty":                 {Value: "", ExpectError: true},
+		"Missing cell":          {Value: nil, ExpectError: true},
+		"Negative serial":       {Value: -3.0, ExpectError: true},
+		"Boolean":               {Value: true, ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		got, err := TimeFromSheet(data.Value, DefaultDateLayouts, time.UTC)
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if data.ExpectError {
+			if _, ok := err.(*DateError); !ok {
+				t.Errorf("%s\n\tExpected a *DateError, Got: %T\n", testcase, err)
+			}
+			continue
+		}
+		if !got.Equal(may1) {
+			t.Errorf("%s\n\tExpected: %v, Got: %v\n", testcase, may1, got)
+		}
+	}
+}
+
+func TestCellName(t *testing.T) {
+	testCases := map[string]struct{ Row, Column int }{"A1": {1, 0}, "E12": {12, 4}, "Z3": {3, 25}, "AA2": {2, 26}, "AB12": {12, 27}}
+	for expected, data := range testCases {
+		if got := CellName(data.Row, data.Column); got != expected {
+			t.Errorf("CellName(%d, %d)\n\tExpected: %s, Got: %s\n", data.Row, data.Column, expected, got)
+		}
+	}
+}
+
+func TestDaysLeftAt(t *testing.T) {
+	lagos := DefaultLocation()
+	entry := SheetEntry{EndDate: time.Date(2024, time.May, 1, 0, 0, 0, 0, lagos)}
+	testCases := map[string]struct {
+		Now      time.Time
+		Expected int
+	}{
+		"Start of the day before":         {Now: time.Date(2024, time.April, 30, 0, 0, 0, 0, lagos), Expected: 1},
+		"Last second of the day before":   {Now: time.Date(2024, time.April, 30, 23, 59, 59, 0, lagos), Expected: 1},
+		"Midnight WAT of the end date":    {Now: time.Date(2024, time.May, 1, 0, 0, 0, 0, lagos), Expected: 0},
+		"Still April 30 in UTC":           {Now: time.Date(2024, time.April, 30, 23, 30, 0, 0, time.UTC), Expected: 0},
+		"Last second of the end date":     {Now: time.Date(2024, time.May, 1, 23, 59, 59, 0, lagos), Expected: 0},
+		"Still May 1 in UTC":              {Now: time.Date(2024, time.May, 1, 23, 30, 0, 0, time.UTC), Expected: -1},
+		"Midnight WAT after the end date": {Now: time.Date(2024, time.May, 2, 0, 0, 0, 0, lagos), Expected: -1},
+		"A week before":                   {Now: time.Date(2024, time.April, 24, 12, 0, 0, 0, lagos), Expected: 7},
+		"Across a month and year":         {Now: time.Date(2023, time.December, 31, 22, 0, 0, 0, lagos), Expected: 122},
+	}
+	for testcase, data := range testCases {
+		if got := entry.DaysLeftAt(data.Now); got != data.Expected {
+			t.Errorf("%s\n\tExpected: %d, Got: %d\n", testcase, data.Expected, got)
+		}
+	}
+}
+
+func TestParserLocation(t *testing.T) {
+	lagos := DefaultLocation()
+	parser, err := NewParser([]interface{}{"First Name", "Email", "End Date"}, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	entry, err := parser.NewSheetEntry(2, []interface{}{"Ada", "ada@example.com", "01/05/24"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if expected := time.Date(2024, time.May, 1, 0, 0, 0, 0, lagos); !entry.EndDate.Equal(expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, entry.EndDate)
+	}
+	// 23:30 UTC on April 30 is already the end date in Lagos
+	if got := entry.DaysLeftAt(time.Date(2024, time.April, 30, 23, 30, 0, 0, time.UTC)); got != 0 {
+		t.Errorf("Expected 0 days left, Got: %d", got)
+	}
+}
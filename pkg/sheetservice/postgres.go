@@ -0,0 +1,80 @@
+package sheetsservice
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	// Registers the postgres driver with database/sql
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// PostgresTokenStore keeps the token in a row of the oauth_tokens table of a Postgres database, such as Heroku
+// Postgres, so that it outlives the machine the app runs on
+type PostgresTokenStore struct {
+	db     *sql.DB
+	name   string
+	cipher *tokenCipher
+}
+
+// NewPostgresTokenStore connects to the database at url and creates the oauth_tokens table if it doesn't exist.
+// The token is kept in the row called name, encrypted with key as for NewEncryptedFileTokenStore unless key is nil.
+func NewPostgresTokenStore(url, name string, key []byte) (*PostgresTokenStore, error) {
+	store := &PostgresTokenStore{name: name}
+	if key != nil {
+		c, err := newTokenCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		store.cipher = c
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to open the token database")
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS oauth_tokens (
+		name TEXT PRIMARY KEY,
+		token BYTEA NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, errors.WithMessage(err, "Unable to create the oauth_tokens table")
+	}
+	store.db = db
+	return store, nil
+}
+
+// Load reads the token from its row
+func (p *PostgresTokenStore) Load() (*oauth2.Token, error) {
+	var b []byte
+	err := p.db.QueryRow(`SELECT token FROM oauth_tokens WHERE name = $1`, p.name).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("No token named %q in the database", p.name)
+	} else if err != nil {
+		return nil, errors.WithMessage(err, "Unable to read the token from the database")
+	}
+	if p.cipher == nil {
+		return decodeToken(b)
+	}
+	tok, err := p.cipher.open(b)
+	return tok, errors.WithMessage(err, "Unable to decrypt the token in the database")
+}
+
+// Save writes the token to its row, replacing the one there
+func (p *PostgresTokenStore) Save(token *oauth2.Token) error {
+	var b []byte
+	var err error
+	if p.cipher == nil {
+		b, err = json.Marshal(token)
+	} else {
+		b, err = p.cipher.seal(token)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(`INSERT INTO oauth_tokens (name, token, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET token = excluded.token, updated_at = excluded.updated_at`, p.name, b)
+	return errors.WithMessage(err, "Unable to save the token to the database")
+}
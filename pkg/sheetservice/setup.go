@@ -1,11 +1,9 @@
 package sheetsservice
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -18,15 +16,50 @@ import (
 
 const tokenFile = "token.json"
 
-// NewSheetsService creates a new sheets service with the given client secret
-func NewSheetsService(secret []byte) *sheets.Service {
-	// If modifying these scopes, delete your previously saved client_secret.json.
-	config, err := google.ConfigFromJSON(secret, sheets.SpreadsheetsReadonlyScope)
-	if err != nil {
-		log.Printf("Unable to parse client secret file to config: %v", err)
+// Credential types found in the "type" field of a Google credentials file
+const (
+	credentialServiceAccount = "service_account"
+)
+
+// Options configures how the Sheets client authenticates
+type Options struct {
+	// Subject is the user a service account impersonates through domain-wide delegation.
+	// Leave it empty for the service account to act as itself.
+	Subject string
+	// Interactive allows asking for an OAuth authorization code on the terminal when no token is saved.
+	// It must be false when running as a server, where nobody can answer the prompt.
+	Interactive bool
+	// TokenStore keeps the OAuth token and any refreshed versions of it. Defaults to token.json.
+	TokenStore TokenStore
+}
+
+// NewSheetsService creates a new sheets service with the given secret. The secret may be either an OAuth client secret
+// for the installed-app flow or a service account key, which is detected from its "type" field.
+func NewSheetsService(secret []byte, opts Options) *sheets.Service {
+	var credentials struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(secret, &credentials); err != nil {
+		log.Printf("Unable to parse client secret: %v", err)
 		return nil
 	}
-	client := getClient(config)
+	var client *http.Client
+	if credentials.Type == credentialServiceAccount {
+		client = getServiceAccountClient(secret, opts.Subject)
+	} else {
+		// If modifying these scopes, delete your previously saved token.json.
+		// Write access is needed to record the reminder status in the sheet.
+		config, err := google.ConfigFromJSON(secret, sheets.SpreadsheetsScope)
+		if err != nil {
+			log.Printf("Unable to parse client secret file to config: %v", err)
+			return nil
+		}
+		store := opts.TokenStore
+		if store == nil {
+			store = FileTokenStore{Path: tokenFile}
+		}
+		client = getClient(config, store, opts.Interactive)
+	}
 	if client == nil {
 		return nil
 	}
@@ -38,20 +71,45 @@ func NewSheetsService(secret []byte) *sheets.Service {
 	return srv
 }
 
+// Creates a client authenticated as a service account, impersonating subject if it is not empty.
+func getServiceAccountClient(key []byte, subject string) *http.Client {
+	config, err := google.JWTConfigFromJSON(key, sheets.SpreadsheetsScope)
+	if err != nil {
+		log.Printf("Unable to parse service account key to config: %v", err)
+		return nil
+	}
+	config.Subject = subject
+	return config.Client(context.Background())
+}
+
 // Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) *http.Client {
-	tok, err := tokenFromEnvOrFile(os.Getenv("TOKEN"))
+// The token is only requested from the web if interactive is true. Refreshed tokens are saved to the store.
+func getClient(config *oauth2.Config, store TokenStore, interactive bool) *http.Client {
+	tok, err := store.Load()
+	if err != nil {
+		// Fall back to the token in the environment
+		tok, err = tokenFromEnv(os.Getenv("TOKEN"))
+	}
 	if err != nil {
+		if !interactive {
+			log.Printf("No saved OAuth token and none in the TOKEN environment variable: %v\n", err)
+			return nil
+		}
 		tok, err = getTokenFromWeb(config)
 		if err != nil {
 			log.Printf("Unable to retrieve token from web: %+v\n", err)
 			return nil
 		}
-		if err = saveToken(tok); err != nil {
+		if err = store.Save(tok); err != nil {
 			log.Printf("%+v\n", err)
 		}
 	}
-	return config.Client(context.Background(), tok)
+	ctx := context.Background()
+	return oauth2.NewClient(ctx, &persistingTokenSource{
+		base:  config.TokenSource(ctx, tok),
+		store: store,
+		last:  tok,
+	})
 }
 
 // Request a token from the web, then return the retrieved token.
@@ -72,34 +130,10 @@ func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
 	return tok, nil
 }
 
-// Retrieves a token from a local file. It first checks the "TOKEN" environment variable for the token.
-func tokenFromEnvOrFile(sheetsAPIToken string) (*oauth2.Token, error) {
-	var (
-		tok = &oauth2.Token{}
-		err error
-	)
-	// Try reading from the environment variable
-	if sheetsAPIToken != "" {
-		err = json.NewDecoder(bytes.NewReader([]byte(sheetsAPIToken))).Decode(tok)
-	} else {
-		f, err := ioutil.ReadFile(tokenFile)
-		if err != nil {
-			return nil, err
-		}
-		buf := bytes.NewReader(f)
-		err = json.NewDecoder(buf).Decode(tok)
-	}
-	return tok, err
-}
-
-// Saves a token to token.json
-func saveToken(token *oauth2.Token) error {
-	f, err := os.Create(tokenFile)
-	if err != nil {
-		return errors.WithMessage(err, "Unable to create file "+tokenFile)
-	}
-	if err = json.NewEncoder(f).Encode(token); err != nil {
-		return err
+// Reads a token from the value of the "TOKEN" environment variable.
+func tokenFromEnv(sheetsAPIToken string) (*oauth2.Token, error) {
+	if sheetsAPIToken == "" {
+		return nil, errors.New("TOKEN is not set")
 	}
-	return nil
+	return decodeToken([]byte(sheetsAPIToken))
 }
@@ -0,0 +1,177 @@
+package sheetsservice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// TokenStore loads and saves the OAuth token so that it survives restarts
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+}
+
+// FileTokenStore keeps the token as JSON in a file
+type FileTokenStore struct {
+	Path string
+}
+
+// Load reads the token from the file
+func (f FileTokenStore) Load() (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(b)
+}
+
+// Save writes the token to the file
+func (f FileTokenStore) Save(token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.Path, b)
+}
+
+// EncryptedFileTokenStore keeps the token in a file encrypted with AES-GCM
+type EncryptedFileTokenStore struct {
+	Path   string
+	cipher *tokenCipher
+}
+
+// NewEncryptedFileTokenStore creates a store for the file at path encrypted with key, which must be 16, 24 or 32 bytes
+func NewEncryptedFileTokenStore(path string, key []byte) (*EncryptedFileTokenStore, error) {
+	c, err := newTokenCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFileTokenStore{Path: path, cipher: c}, nil
+}
+
+// Load reads and decrypts the token from the file
+func (e *EncryptedFileTokenStore) Load() (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := e.cipher.open(b)
+	return tok, errors.WithMessage(err, "Unable to decrypt token file "+e.Path)
+}
+
+// Save encrypts the token and writes it to the file
+func (e *EncryptedFileTokenStore) Save(token *oauth2.Token) error {
+	b, err := e.cipher.seal(token)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.Path, b)
+}
+
+// tokenCipher encrypts tokens with AES-GCM
+type tokenCipher struct {
+	aead cipher.AEAD
+}
+
+// newTokenCipher creates a cipher with key, which must be 16, 24 or 32 bytes
+func newTokenCipher(key []byte) (*tokenCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid token encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenCipher{aead: aead}, nil
+}
+
+// seal encrypts the token, prefixed with a random nonce
+func (c *tokenCipher) seal(token *oauth2.Token) ([]byte, error) {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// open decrypts a token encrypted by seal
+func (c *tokenCipher) open(b []byte) (*oauth2.Token, error) {
+	size := c.aead.NonceSize()
+	if len(b) < size {
+		return nil, errors.New("Encrypted token is too short")
+	}
+	plain, err := c.aead.Open(nil, b[:size], b[size:], nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(plain)
+}
+
+// persistingTokenSource saves the token to a store whenever the underlying source hands out a new one,
+// which happens when oauth2 refreshes an expired access token.
+type persistingTokenSource struct {
+	mu    sync.Mutex
+	base  oauth2.TokenSource
+	store TokenStore
+	last  *oauth2.Token
+}
+
+// Token returns a token from the underlying source, saving it first if it changed
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := p.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil || tok.AccessToken != p.last.AccessToken || tok.RefreshToken != p.last.RefreshToken {
+		if err := p.store.Save(tok); err != nil {
+			// The token is still good for this process, so only log the failure
+			log.Printf("%+v\n", errors.WithMessage(err, "Unable to save refreshed token"))
+		}
+		p.last = tok
+	}
+	return tok, nil
+}
+
+func decodeToken(b []byte) (*oauth2.Token, error) {
+	tok := &oauth2.Token{}
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// writeFileAtomic replaces the file at path so that readers never see a partly written token
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.WithMessage(err, "Unable to create file "+path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,89 @@
+package sheetsservice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// memoryTokenStore counts the tokens saved to it
+type memoryTokenStore struct {
+	saved []*oauth2.Token
+}
+
+func (m *memoryTokenStore) Load() (*oauth2.Token, error) {
+	return m.saved[len(m.saved)-1], nil
+}
+
+func (m *memoryTokenStore) Save(token *oauth2.Token) error {
+	m.saved = append(m.saved, token)
+	return nil
+}
+
+// sequenceTokenSource hands out the given tokens in order, repeating the last one
+type sequenceTokenSource []*oauth2.Token
+
+func (s *sequenceTokenSource) Token() (*oauth2.Token, error) {
+	tok := (*s)[0]
+	if len(*s) > 1 {
+		*s = (*s)[1:]
+	}
+	return tok, nil
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	initial := &oauth2.Token{AccessToken: "a1", RefreshToken: "r"}
+	refreshed := &oauth2.Token{AccessToken: "a2", RefreshToken: "r"}
+	store := &memoryTokenStore{}
+	src := &persistingTokenSource{
+		base:  &sequenceTokenSource{initial, initial, refreshed, refreshed},
+		store: store,
+		last:  initial,
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := src.Token(); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+	}
+	if len(store.saved) != 1 || store.saved[0].AccessToken != "a2" {
+		t.Errorf("Expected only the refreshed token to be saved, Got: %+v", store.saved)
+	}
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token.json")
+	store, err := NewEncryptedFileTokenStore(path, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := store.Save(&oauth2.Token{AccessToken: "secret-access", RefreshToken: "secret-refresh"}); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret") {
+		t.Errorf("Expected the token file to be encrypted")
+	}
+	tok, err := store.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if tok.AccessToken != "secret-access" || tok.RefreshToken != "secret-refresh" {
+		t.Errorf("Unexpected token %+v", tok)
+	}
+	other, _ := NewEncryptedFileTokenStore(path, []byte("fedcba9876543210fedcba9876543210"))
+	if _, err := other.Load(); err == nil {
+		t.Errorf("Expected an error when decrypting with the wrong key")
+	}
+}
@@ -0,0 +1,50 @@
+package source
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CSV reads subscribers from a comma-separated file, such as one exported from the spreadsheet
+type CSV struct {
+	Path string
+}
+
+// Rows reads every record of the file
+func (c *CSV) Rows(ctx context.Context) ([][]interface{}, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to open CSV file "+c.Path)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	// Exported sheets drop trailing empty cells, so rows may differ in length
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to read CSV file "+c.Path)
+	}
+	rows := make([][]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = make([]interface{}, len(record))
+		for j, value := range record {
+			rows[i][j] = value
+		}
+	}
+	// Skip the byte order mark some spreadsheet programs write
+	if len(rows) > 0 && len(records[0]) > 0 {
+		rows[0][0] = trimBOM(records[0][0])
+	}
+	return rows, nil
+}
+
+func trimBOM(s string) string {
+	const bom = "\ufeff"
+	if len(s) >= len(bom) && s[:len(bom)] == bom {
+		return s[len(bom):]
+	}
+	return s
+}
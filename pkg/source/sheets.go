@@ -0,0 +1,117 @@
+package source
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/retry"
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/sheetdata"
+	"github.com/pkg/errors"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// Sheets reads subscribers from a range of a Google spreadsheet
+type Sheets struct {
+	Service       *sheets.Service
+	SpreadsheetID string
+	// Range is in A1 notation and must start at the header row, e.g. "Sheet1!A1:F"
+	Range string
+	// ValueRenderOption is FORMATTED_VALUE, UNFORMATTED_VALUE or FORMULA. With UNFORMATTED_VALUE, the default,
+	// numbers are returned as float64 and dates as serial numbers, so they don't depend on the cell format.
+	ValueRenderOption string
+	// Retry decides how failed API calls are retried. The zero value doesn't retry.
+	Retry retry.Policy
+}
+
+// Rows reads the range from the spreadsheet
+func (s *Sheets) Rows(ctx context.Context) ([][]interface{}, error) {
+	renderOption := s.ValueRenderOption
+	if renderOption == "" {
+		renderOption = "UNFORMATTED_VALUE"
+	}
+	var resp *sheets.ValueRange
+	err := s.Retry.Do(ctx, func() (err error) {
+		resp, err = s.Service.Spreadsheets.Values.Get(s.SpreadsheetID, s.Range).
+			ValueRenderOption(renderOption).
+			DateTimeRenderOption("SERIAL_NUMBER").
+			Do()
+		return err
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to read the spreadsheet")
+	}
+	return resp.Values, nil
+}
+
+// Start returns the top left cell of Range
+func (s *Sheets) Start() (RangeStart, error) {
+	return ParseRangeStart(s.Range)
+}
+
+// WriteStatus writes all the updates to the spreadsheet in a single request
+func (s *Sheets) WriteStatus(ctx context.Context, updates []StatusUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	start, err := ParseRangeStart(s.Range)
+	if err != nil {
+		return err
+	}
+	data := make([]*sheets.ValueRange, 0, len(updates))
+	for _, u := range updates {
+		data = append(data, &sheets.ValueRange{
+			Range:  start.Sheet + sheetdata.CellName(u.Row, u.Column),
+			Values: [][]interface{}{{u.Value}},
+		})
+	}
+	err = s.Retry.Do(ctx, func() error {
+		_, err := s.Service.Spreadsheets.Values.BatchUpdate(s.SpreadsheetID, &sheets.BatchUpdateValuesRequest{
+			Data:             data,
+			ValueInputOption: "RAW",
+		}).Do()
+		return err
+	})
+	if err != nil {
+		return errors.WithMessage(err, "Unable to write reminder status to the spreadsheet")
+	}
+	return nil
+}
+
+// RangeStart is the top left cell of a range in A1 notation
+type RangeStart struct {
+	// Sheet is the quoted sheet name including the "!" separator, or empty for the first sheet
+	Sheet string
+	// Row is numbered from 1 and Column from 0, as in the spreadsheet
+	Row    int
+	Column int
+}
+
+// ParseRangeStart returns the top left cell of a range such as "Sheet1!B2:F" or "'Hub Members'!A1:E100".
+// A range of whole columns such as "A:F" starts at row 1.
+func ParseRangeStart(rng string) (RangeStart, error) {
+	var start RangeStart
+	if bang := strings.LastIndex(rng, "!"); bang >= 0 {
+		start.Sheet, rng = rng[:bang+1], rng[bang+1:]
+	}
+	cell := rng
+	if colon := strings.Index(rng, ":"); colon >= 0 {
+		cell = rng[:colon]
+	}
+	cell = strings.ToUpper(strings.Replace(cell, "$", "", -1))
+	letters := strings.TrimRight(cell, "0123456789")
+	if letters == "" {
+		return RangeStart{}, errors.Errorf("Range %q doesn't start with a column", rng)
+	}
+	col, err := columnIndex(letters + "1")
+	if err != nil {
+		return RangeStart{}, errors.Errorf("Invalid range %q", rng)
+	}
+	start.Column, start.Row = col, 1
+	if digits := cell[len(letters):]; digits != "" {
+		if start.Row, err = strconv.Atoi(digits); err != nil || start.Row < 1 {
+			return RangeStart{}, errors.Errorf("Invalid range %q", rng)
+		}
+	}
+	return start, nil
+}
@@ -0,0 +1,37 @@
+package source
+
+import "context"
+
+// SubscriberSource reads the subscribers table. The first row holds the column headers.
+// Cell values are strings, except that numeric cells from spreadsheet files may be float64.
+// Sources that call a remote API stop retrying it once ctx is done.
+type SubscriberSource interface {
+	Rows(ctx context.Context) ([][]interface{}, error)
+}
+
+// StatusUpdate is a value to write to one cell of the subscribers table
+type StatusUpdate struct {
+	// Row is the row number in the sheet and Column the zero-based sheet column
+	Row    int
+	Column int
+	Value  string
+}
+
+// StatusWriter is implemented by sources that can record the outcome of reminders next to each subscriber
+type StatusWriter interface {
+	WriteStatus(ctx context.Context, updates []StatusUpdate) error
+}
+
+// Positioner is implemented by sources whose rows don't start at cell A1 of the sheet.
+// Sources that don't implement it start at A1.
+type Positioner interface {
+	Start() (RangeStart, error)
+}
+
+// StartOf returns where the rows of src start in the sheet
+func StartOf(src SubscriberSource) (RangeStart, error) {
+	if p, ok := src.(Positioner); ok {
+		return p.Start()
+	}
+	return RangeStart{Row: 1}, nil
+}
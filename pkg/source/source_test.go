@@ -0,0 +1,189 @@
+package source
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SprintHubNigeria/google_spreadsheet/pkg/retry"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCSVRows(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscribers.csv")
+	content := "\ufeffFirst Name,Last Name,Email,End Date\nAda,Obi,ada@example.com,01/05/24\nBola,,bola@example.com\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := (&CSV{Path: path}).Rows(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := [][]interface{}{
+		{"First Name", "Last Name", "Email", "End Date"},
+		{"Ada", "Obi", "ada@example.com", "01/05/24"},
+		{"Bola", "", "bola@example.com"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, rows)
+	}
+}
+
+// writeXLSX writes a minimal workbook with the given parts
+func writeXLSX(t *testing.T, path string, parts map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXLSXRows(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscribers.xlsx")
+	writeXLSX(t, path, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+			xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Subscribers" sheetId="2" r:id="rId2"/></sheets>
+		</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Target="worksheets/sheet2.xml"/>
+		</Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>First Name</t></si><si><t>Email</t></si><si><t>End Date</t></si>
+			<si><r><t>Ad</t></r><r><t>a</t></r></si>
+		</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="D1" t="s"><v>2</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>3</v></c><c r="B3" t="inlineStr"><is><t>ada@example.com</t></is></c><c r="D3"><v>45413</v></c></row>
+		</sheetData></worksheet>`,
+	})
+	rows, err := (&XLSX{Path: path, Sheet: "Subscribers"}).Rows(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := [][]interface{}{
+		{"First Name", "Email", "", "End Date"},
+		{},
+		{"Ada", "ada@example.com", "", 45413.0},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, rows)
+	}
+	if _, err := (&XLSX{Path: path, Sheet: "Missing"}).Rows(context.Background()); err == nil {
+		t.Errorf("Expected an error for a missing worksheet")
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	testCases := map[string]int{"A1": 0, "D3": 3, "Z10": 25, "AA2": 26, "AB12": 27}
+	for ref, expected := range testCases {
+		if got, err := columnIndex(ref); err != nil || got != expected {
+			t.Errorf("columnIndex(%q)\n\tExpected: %d, Got: %d (%v)\n", ref, expected, got, err)
+		}
+	}
+	for _, ref := range []string{"", "12", "A"} {
+		if _, err := columnIndex(ref); err == nil {
+			t.Errorf("columnIndex(%q)\n\tExpected an error\n", ref)
+		}
+	}
+}
+
+func TestParseRangeStart(t *testing.T) {
+	testCases := map[string]struct {
+		Range       string
+		Expected    RangeStart
+		ExpectError bool
+	}{
+		"Sheet and cell":        {Range: "Sheet1!A1:F", Expected: RangeStart{Sheet: "Sheet1!", Row: 1, Column: 0}},
+		"Offset start":          {Range: "Sheet1!B3:G", Expected: RangeStart{Sheet: "Sheet1!", Row: 3, Column: 1}},
+		"Quoted sheet":          {Range: "'Hub Members'!$AA$2:AF", Expected: RangeStart{Sheet: "'Hub Members'!", Row: 2, Column: 26}},
+		"Whole columns":         {Range: "C:F", Expected: RangeStart{Row: 1, Column: 2}},
+		"Rows only should fail": {Range: "Sheet1!1:10", ExpectError: true},
+	}
+	for testcase, data := range testCases {
+		start, err := ParseRangeStart(data.Range)
+		if (err != nil) != data.ExpectError {
+			t.Errorf("%s\n\tExpected error: %v, Got: %v\n", testcase, data.ExpectError, err)
+			continue
+		}
+		if data.ExpectError {
+			continue
+		}
+		if start != data.Expected {
+			t.Errorf("%s\n\tExpected: %+v, Got: %+v\n", testcase, data.Expected, start)
+		}
+	}
+}
+
+func TestSheetsRowsRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, `{"error": {"code": 503, "message": "Backend Error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"range": "Sheet1!A1:B2", "values": [["First Name", "Email"], ["Ada", "ada@example.com"]]}`))
+	}))
+	defer server.Close()
+	srv, err := sheets.New(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.BasePath = server.URL + "/"
+	src := &Sheets{
+		Service:       srv,
+		SpreadsheetID: "sheet",
+		Range:         "Sheet1!A1:B",
+		Retry:         retry.Policy{Attempts: 2, Base: time.Millisecond},
+	}
+	rows, err := src.Rows(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if calls != 2 || len(rows) != 2 || rows[1][1] != "ada@example.com" {
+		t.Errorf("Expected 2 calls and 2 rows, Got: %d calls %v", calls, rows)
+	}
+
+	// A done context stops the retries
+	calls = 0
+	src.Retry.Base = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := src.Rows(ctx); err == nil || calls != 1 {
+		t.Errorf("Expected 1 failed call, Got: %d calls %v", calls, err)
+	}
+}
@@ -0,0 +1,203 @@
+package source
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// XLSX reads subscribers from a worksheet of an Excel workbook, such as one downloaded from Google Sheets.
+// Text cells are returned as strings and numeric cells, including dates, as float64.
+type XLSX struct {
+	Path string
+	// Sheet is the name of the worksheet to read. The first worksheet is used if it is empty.
+	Sheet string
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is rich or plain text, as used by shared and inline strings
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Rows reads every row of the worksheet
+func (x *XLSX) Rows(ctx context.Context) ([][]interface{}, error) {
+	z, err := zip.OpenReader(x.Path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to open XLSX file "+x.Path)
+	}
+	defer z.Close()
+	files := make(map[string]*zip.File, len(z.File))
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	sheetPath, err := x.sheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxWorksheet
+	if err := decodeZipXML(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+	var rows [][]interface{}
+	for i, r := range sheet.Rows {
+		// Rows without any cells are left out of the file, so place each row by its number
+		rowNum := r.R
+		if rowNum == 0 {
+			rowNum = len(rows) + 1
+		}
+		for len(rows) < rowNum {
+			rows = append(rows, []interface{}{})
+		}
+		row := rows[rowNum-1]
+		for j, c := range r.Cells {
+			col := j
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, errors.WithMessage(err, "Bad cell reference in row "+strconv.Itoa(i+1))
+				}
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, errors.Errorf("Bad shared string index %q in cell %s", c.Value, c.Ref)
+				}
+				row[col] = shared.Items[n].String()
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			case "str", "b", "e":
+				row[col] = c.Value
+			default:
+				if c.Value == "" {
+					continue
+				}
+				n, err := strconv.ParseFloat(c.Value, 64)
+				if err != nil {
+					return nil, errors.Errorf("Bad number %q in cell %s", c.Value, c.Ref)
+				}
+				row[col] = n
+			}
+		}
+		rows[rowNum-1] = row
+	}
+	return rows, nil
+}
+
+// sheetPath finds the file holding the worksheet named x.Sheet
+func (x *XLSX) sheetPath(files map[string]*zip.File) (string, error) {
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, s := range workbook.Sheets {
+		if x.Sheet != "" && s.Name != x.Sheet {
+			continue
+		}
+		for _, rel := range rels.Relationships {
+			if rel.ID != s.RID {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+		return "", errors.Errorf("Worksheet %q has no file in %s", s.Name, x.Path)
+	}
+	return "", errors.Errorf("No worksheet %q in %s", x.Sheet, x.Path)
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return errors.Errorf("Missing %s in XLSX file", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return errors.WithMessage(err, "Unable to open "+name)
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil && err != io.EOF {
+		return errors.WithMessage(err, "Unable to parse "+name)
+	}
+	return nil
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12"
+func columnIndex(ref string) (int, error) {
+	col := 0
+	for i, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A') + 1
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		return col - 1, nil
+	}
+	return 0, errors.Errorf("Invalid cell reference %q", ref)
+}